@@ -2,8 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"context"
 
@@ -39,27 +44,79 @@ func init() {
 }
 
 func main() {
+	// Zona horaria de la institución: la de las fechas guardadas en MySQL y los horarios
+	zonaInstitucion = cargarZonaInstitucion()
+
 	cfg := mysql.NewConfig()          //Create the cfg for MySQL
 	cfg.User = os.Getenv("DB_USER")   //User
 	cfg.Passwd = os.Getenv("DB_PASS") //Pass
 	cfg.Net = "tcp"
 	cfg.Addr = os.Getenv("DB_ADDR") + ":" + os.Getenv("DB_ADDR_PORT")
 	cfg.DBName = os.Getenv("DB_NAME")
+	cfg.Loc = zonaInstitucion // Valores time.Time enviados a MySQL
 	var err2 error
 	db, err2 = sql.Open("mysql", cfg.FormatDSN())
 	if err2 != nil {
 		log.Fatal("Error connecting to database:", err2)
 	}
 	defer db.Close()
+
+	// Pool de conexiones al AD con la cuenta de servicio
+	ldapPool = nuevoPoolLDAP()
+
+	// Política de permisos por grupo del directorio
+	politicaPermisos = cargarPoliticaPermisos()
+
+	// Límites de intentos de inicio de sesión
+	bloqueoCfg = leerConfigBloqueo()
+
+	// Clave para cifrar los secretos TOTP
+	claveTOTP = cargarClaveTOTP()
+
+	// Cola de escritura de Logs por lotes
+	auditoria = nuevoEscritorAuditoria()
+
+	// Archivado de Logs antiguos según la política de retención
+	retencionCfg = leerConfigRetencion()
+	iniciarRetencionLogs()
+
 	router := gin.Default()
-	router.Use(apiKeyAuth())
+	router.Use(requestID())
+
+	// Rutas que no pueden enviar la API key (aplicaciones de calendario, navegadores)
+	public := router.Group("/api/v1")
+	public.GET("/calendar/feed/:token", getCalendarFeed)
+	public.GET("/share/:token", getSharedSchedule)
+	public.POST("/share/:token", getSharedSchedule)
 
 	v1 := router.Group("/api/v1")
+	v1.Use(apiKeyAuth())
 	registerV1Routes(v1)
 
-	router.Run("0.0.0.0:8080") // The port number for expone the API
+	srv := &http.Server{
+		Addr:    "0.0.0.0:8080", // The port number for expone the API
+		Handler: router,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Error iniciando el servidor:", err)
+		}
+	}()
+
+	// Apagado ordenado: se terminan las peticiones en curso y se vacía la cola de auditoría
+	senal := make(chan os.Signal, 1)
+	signal.Notify(senal, os.Interrupt, syscall.SIGTERM)
+	<-senal
+
+	log.Println("Apagando servidor...")
+	ctxApagado, cancelar := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelar()
 
-	//router.Run(":8080")
+	if err := srv.Shutdown(ctxApagado); err != nil {
+		log.Printf("Error apagando el servidor: %v", err)
+	}
+	auditoria.cerrar(10 * time.Second)
 }
 
 
@@ -75,14 +132,54 @@ func registerV1Routes(router gin.IRouter) {
 		protected.GET("/schedules/official/users/:id", UserGetMiddleware(), getOfficialScheduleByUserId)
 		protected.POST("/schedules/activities/times", getActivitiesTimesData)
 
+		// Calendario (.ics) con horario oficial, actividades personales y recordatorios
+		protected.GET("/schedules/users/:id/ics", UserGetMiddleware(), exportScheduleICS)
+		protected.GET("/schedules/users/:id/conflicts", UserGetMiddleware(), getScheduleConflicts)
+		protected.GET("/schedules/users/:id/free-slots", UserGetMiddleware(), getFreeSlots)
+		protected.GET("/schedules/users/:id/timetable", UserGetMiddleware(), exportTimetable)
+
+		// Ocurrencias con fecha del horario y recordatorios
+		protected.GET("/calendar", getCalendar)
+		protected.GET("/calendar/now", getNowAndNext)
+
+		// Disponibilidad compartida entre usuarios (solo ocupado/libre)
+		protected.GET("/availability/grants", getAvailabilityGrants)
+		protected.POST("/availability/grants", sinSuplantacion(), grantAvailability)
+		protected.POST("/availability/grants/revoke", sinSuplantacion(), revokeAvailability)
+		protected.GET("/availability/users/:id/busy", getUserBusy)
+		protected.GET("/availability/common", getCommonFreeSlots)
+
+		// Enlaces de solo lectura para compartir el horario
+		protected.GET("/schedules/share", getShareLinks)
+		protected.POST("/schedules/share", sinSuplantacion(), createShareLink)
+		protected.POST("/schedules/share/revoke", sinSuplantacion(), revokeShareLink)
+
+		// Zona horaria preferida del usuario
+		protected.GET("/preferences/timezone", getTimezonePreference)
+		protected.POST("/preferences/timezone", setTimezonePreference)
+
+		// Enlace de suscripción al calendario
+		protected.GET("/calendar/feed-token", sinSuplantacion(), getFeedToken)
+		protected.POST("/calendar/feed-token", sinSuplantacion(), createFeedToken)
+		protected.POST("/calendar/feed-token/rotate", sinSuplantacion(), rotateFeedToken)
+		protected.POST("/calendar/feed-token/revoke", sinSuplantacion(), revokeFeedToken)
+
 		// Schedule import
-		protected.POST("/schedules/import", RoleMiddleware(os.Getenv("ROLE_ADM")), importSchedule)
+		protected.POST("/schedules/import", PermissionMiddleware(permisoImportarHorario), importSchedule)
 
 		//	Academic periods
 		protected.GET("/academic-periods", getAcademicPeriods)
-		protected.POST("/academic-periods/insert", RoleMiddleware(os.Getenv("ROLE_ADM")), addAcademicPeriod)
-		protected.POST("/academic-periods/update", RoleMiddleware(os.Getenv("ROLE_ADM")), updateAcademicPeriod)
-		protected.POST("/academic-periods/delete", RoleMiddleware(os.Getenv("ROLE_ADM")), deleteAcademicPeriod)
+		protected.POST("/academic-periods/insert", PermissionMiddleware(permisoPeriodosEscribir), addAcademicPeriod)
+		protected.POST("/academic-periods/update", PermissionMiddleware(permisoPeriodosEscribir), updateAcademicPeriod)
+		protected.POST("/academic-periods/delete", PermissionMiddleware(permisoPeriodosEscribir), deleteAcademicPeriod)
+
+		// Días sin clase y excepciones de sesiones
+		protected.GET("/academic-periods/:id/non-class-days", getNonClassDays)
+		protected.POST("/academic-periods/non-class-days", PermissionMiddleware(permisoPeriodosEscribir), addNonClassDay)
+		protected.POST("/academic-periods/non-class-days/delete", PermissionMiddleware(permisoPeriodosEscribir), deleteNonClassDay)
+		protected.GET("/schedules/exceptions", getClassExceptions)
+		protected.POST("/schedules/exceptions", PermissionMiddleware(permisoPeriodosEscribir), addClassException)
+		protected.POST("/schedules/exceptions/delete", PermissionMiddleware(permisoPeriodosEscribir), deleteClassException)
 
 		// Personal comments
 		protected.GET("/comments/personal/users/:id", UserGetMiddleware(), getPersonalCommentsByUserId)
@@ -96,6 +193,7 @@ func registerV1Routes(router gin.IRouter) {
 		protected.POST("/schedules/personal", addPersonalActivity)                                          //Has userCode validation
 		protected.POST("/schedules/personal/update", updatePersonalScheduleByIdCourse)                      //Has userCode validation
 		protected.POST("/schedules/personal/delete-or-recover", deleteOrRecoveryPersonalScheduleByIdCourse) //Has userCode validation
+		protected.POST("/schedules/personal/import-ics", importPersonalICS)                                 //Has userCode validation
 
 		// Tags
 		protected.GET("/tags/users/:id", UserGetMiddleware(), GetTagsByUserId)
@@ -110,6 +208,9 @@ func registerV1Routes(router gin.IRouter) {
 		protected.POST("/reminders/delete-or-recover", deleteOrRecoverReminder) //Has userCode validation
 		protected.POST("/reminders/delete/multiple", deleteMultipleReminder)    //Has userCode validation
 
+		// Deshacer eliminaciones recientes
+		protected.POST("/undo", sinSuplantacion(), undoDeletes) //Has userCode validation
+
 		// Notifications and emails
 		protected.GET("/notifications/users/:id", UserGetMiddleware(), GetNotificaciones)
 
@@ -122,6 +223,27 @@ func registerV1Routes(router gin.IRouter) {
 
 		// Logs
 		protected.POST("/logs", insertLog)
+		protected.GET("/admin/logs", sinSuplantacion(), PermissionMiddleware(permisoLeerAuditoria), getAuditLogs)
+		protected.GET("/admin/logs/retention", sinSuplantacion(), PermissionMiddleware(permisoLeerAuditoria), getRetentionStatus)
+
+		// Permisos
+		protected.GET("/auth/permissions", getMyPermissions)
+		protected.POST("/auth/admins", sinSuplantacion(), PermissionMiddleware(permisoGestionarUsuarios), createAdmin)
+		protected.POST("/auth/unlock", sinSuplantacion(), PermissionMiddleware(permisoGestionarUsuarios), unlockAccount)
+		protected.POST("/auth/change-password", sinSuplantacion(), changeusrpasswd) //Has userCode validation
+
+		// Sesiones
+		protected.GET("/auth/sessions", sinSuplantacion(), getSessions)
+		protected.POST("/auth/sessions/revoke", sinSuplantacion(), revokeSession)
+		protected.POST("/auth/sessions/revoke-all", sinSuplantacion(), revokeAllSessions)
+
+		// Segundo factor
+		protected.POST("/auth/2fa/enroll", sinSuplantacion(), enrollTOTP)
+		protected.POST("/auth/2fa/activate", sinSuplantacion(), activateTOTP)
+		protected.POST("/auth/2fa/disable", sinSuplantacion(), disableTOTP)
+
+		// Suplantación (soporte)
+		protected.POST("/admin/impersonate", sinSuplantacion(), PermissionMiddleware(permisoSuplantar), impersonateUser)
 	}
 
 	// User configuration
@@ -138,13 +260,10 @@ func registerV1Routes(router gin.IRouter) {
 
 	// LDAP/auth
 	router.POST("/auth/login", Auth)
+	router.POST("/auth/login/2fa", loginTOTP)
 	router.POST("/auth/users", createUser)
-	router.POST("/auth/admins", createAdmin)
-	router.POST("/auth/change-password", changeusrpasswd)
+	router.POST("/auth/password-reset/request", requestPasswordReset)
+	router.POST("/auth/password-reset/confirm", confirmPasswordReset)
 	router.GET("/auth/token", autho.validateTokenPublic)
 
-	// Tokens
-	router.POST("/tokens", receiveTokenData)
-	router.POST("/tokens/get", getToken)
-
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
 
@@ -28,3 +30,21 @@ func apiKeyAuth() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Id de petición para correlacionar los registros de auditoría.
+// Se respeta el X-Request-ID que envíe un proxy y se devuelve en la respuesta.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+
+		c.Next()
+	}
+}
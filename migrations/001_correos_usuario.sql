@@ -0,0 +1,6 @@
+-- Correos dirigidos directamente a un usuario (restablecer contraseña),
+-- sin recordatorio asociado.
+ALTER TABLE Correos
+    ADD COLUMN N_idUsuario INT NULL,
+    MODIFY COLUMN N_idToDoList INT NULL,
+    ADD CONSTRAINT fk_correos_usuario FOREIGN KEY (N_idUsuario) REFERENCES Usuarios (N_idUsuario);
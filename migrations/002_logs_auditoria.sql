@@ -0,0 +1,12 @@
+-- Eventos de auditoría estructurados: quién actuó, sobre qué objeto,
+-- desde qué petición e IP, y el estado del objeto antes y después.
+ALTER TABLE Logs
+    ADD COLUMN T_actor VARCHAR(64) NULL,
+    ADD COLUMN T_tipoObjetivo VARCHAR(40) NULL,
+    ADD COLUMN T_idObjetivo VARCHAR(255) NULL,
+    ADD COLUMN T_requestId VARCHAR(64) NULL,
+    ADD COLUMN T_ip VARCHAR(45) NULL,
+    ADD COLUMN J_antes JSON NULL,
+    ADD COLUMN J_despues JSON NULL,
+    ADD INDEX idx_logs_objetivo (T_tipoObjetivo, T_idObjetivo),
+    ADD INDEX idx_logs_request (T_requestId);
@@ -0,0 +1,5 @@
+-- Índices para la búsqueda de GET /admin/logs (la paginación usa la PK N_idLog).
+ALTER TABLE Logs
+    ADD INDEX idx_logs_fecha (Dt_fecha),
+    ADD INDEX idx_logs_accion (T_accion, Dt_fecha),
+    ADD INDEX idx_logs_usuario (N_idUsuario, Dt_fecha);
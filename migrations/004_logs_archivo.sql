@@ -0,0 +1,3 @@
+-- Destino del job de retención cuando AUDIT_ARCHIVE=table.
+-- Misma estructura que Logs para poder mover filas con INSERT ... SELECT *.
+CREATE TABLE IF NOT EXISTS Logs_Archivo LIKE Logs;
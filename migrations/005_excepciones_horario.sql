@@ -0,0 +1,31 @@
+-- Días sin clase de un periodo académico (festivos, semanas de receso).
+-- Un día suelto tiene la misma fecha inicial y final.
+CREATE TABLE IF NOT EXISTS DiasSinClase (
+    N_idDiaSinClase INT AUTO_INCREMENT PRIMARY KEY,
+    N_idPeriodoAcademico INT NOT NULL,
+    Dt_fechaInicio DATE NOT NULL,
+    Dt_fechaFinal DATE NOT NULL,
+    T_tipo VARCHAR(20) NOT NULL,
+    T_motivo VARCHAR(255) NOT NULL,
+    B_isDeleted TINYINT(1) NOT NULL DEFAULT 0,
+    INDEX idx_dias_sin_clase_periodo (N_idPeriodoAcademico, B_isDeleted),
+    CONSTRAINT fk_dias_sin_clase_periodo FOREIGN KEY (N_idPeriodoAcademico) REFERENCES PeriodoAcademico (N_idPeriodoAcademico)
+);
+
+-- Cancelación o reprogramación de una sesión puntual de un NRC.
+-- En una reprogramación los campos nulos conservan el valor de la clase original.
+CREATE TABLE IF NOT EXISTS ExcepcionesClase (
+    N_idExcepcion INT AUTO_INCREMENT PRIMARY KEY,
+    N_idPeriodoAcademico INT NOT NULL,
+    T_nrc VARCHAR(20) NOT NULL,
+    Dt_fecha DATE NOT NULL,
+    T_tipo VARCHAR(20) NOT NULL,
+    Dt_nuevaFecha DATE NULL,
+    T_horaInicio TIME NULL,
+    T_horaFin TIME NULL,
+    T_salon VARCHAR(100) NULL,
+    T_motivo VARCHAR(255) NOT NULL,
+    B_isDeleted TINYINT(1) NOT NULL DEFAULT 0,
+    INDEX idx_excepciones_clase_nrc (N_idPeriodoAcademico, T_nrc, Dt_fecha),
+    CONSTRAINT fk_excepciones_clase_periodo FOREIGN KEY (N_idPeriodoAcademico) REFERENCES PeriodoAcademico (N_idPeriodoAcademico)
+);
@@ -0,0 +1,4 @@
+-- Zona horaria preferida del usuario (nombre IANA, p. ej. America/New_York).
+-- NULL usa la de la institución (TZ_INSTITUCION).
+ALTER TABLE Usuarios
+    ADD COLUMN T_zonaHoraria VARCHAR(64) NULL;
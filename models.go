@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,6 +14,7 @@ import (
 type User struct {
 	Username string
 	Roles    []string
+	MFA      bool
 }
 type UserAuth struct {
 	User string `json:"user"`
@@ -31,9 +33,17 @@ type Claims struct {
 	UserID string   `json:"sub"`
 	Name   string   `json:"name"`
 	Roles  []string `json:"roles"`
+	MFA    bool     `json:"mfa,omitempty"`
+	// Solo en tokens de suplantación: quién actúa realmente y si puede escribir
+	Act      *Actor `json:"act,omitempty"`
+	ReadOnly bool   `json:"ro,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type Actor struct {
+	Sub string `json:"sub"`
+}
+
 // ESTO ES PARA LAS COLISIONES
 type CheckActivitiesTimesData struct {
 	T_idUsuario int `json:"idUsuario"`
@@ -136,18 +146,20 @@ type NewPersonalActivity struct {
 	P_horaInicio  string `json:"P_horaInicio"`
 	P_horaFin     string `json:"P_horaFin"`
 	//P_periodo     int     `json:"P_periodo"`
-	CodUsuario *string `json:"codUsuario"`
+	CodUsuario     *string `json:"codUsuario"`
+	AllowConflicts bool    `json:"allowConflicts"`
 }
 type EditPersonalActivity struct {
-	P_idCurso     int     `json:"P_idCurso"`
-	P_nombreCurso string  `json:"P_nombreCurso"`
-	P_descripcion string  `json:"P_descripcion"`
-	P_fechaInicio string  `json:"P_fechaInicio"`
-	P_fechaFin    string  `json:"P_fechaFin"`
-	P_dia         int     `json:"P_dia"`
-	P_horaInicio  string  `json:"P_horaInicio"`
-	P_horaFin     string  `json:"P_horaFin"`
-	CodUsuario    *string `json:"codUsuario"`
+	P_idCurso      int     `json:"P_idCurso"`
+	P_nombreCurso  string  `json:"P_nombreCurso"`
+	P_descripcion  string  `json:"P_descripcion"`
+	P_fechaInicio  string  `json:"P_fechaInicio"`
+	P_fechaFin     string  `json:"P_fechaFin"`
+	P_dia          int     `json:"P_dia"`
+	P_horaInicio   string  `json:"P_horaInicio"`
+	P_horaFin      string  `json:"P_horaFin"`
+	CodUsuario     *string `json:"codUsuario"`
+	AllowConflicts bool    `json:"allowConflicts"`
 }
 type ofcComments struct {
 	N_idHorario     int           `json:"N_idHorario"`
@@ -188,6 +200,9 @@ type Reminders struct {
 	B_isDeleted         *bool          `json:"B_isDeleted"`
 	T_Prioridad         string         `json:"T_Prioridad"`
 	B_estado            *bool          `json:"B_estado"`
+
+	// Dt_fechaVencimiento en RFC 3339 en la zona del usuario
+	Vencimiento *string `json:"vencimiento"`
 }
 type RemindersTag struct {
 	N_idToDoList        int            `json:"N_idToDoList"`
@@ -202,6 +217,9 @@ type RemindersTag struct {
 	N_idEtiqueta        *int           `json:"N_idEtiqueta"`
 	T_tag_nombre        *string        `json:"T_tag_nombre"`
 	B_tag_isDeleted     *bool          `json:"B_tag_isDeleted"`
+
+	// Dt_fechaVencimiento en RFC 3339 en la zona del usuario
+	Vencimiento *string `json:"vencimiento"`
 }
 type ReminderNewValue struct {
 	P_usuario     int     `json:"P_usuario"`
@@ -255,6 +273,9 @@ type Notificacion struct {
 	T_descripcion    string `json:"descripcion"`
 	Dt_fechaEmision  string `json:"fechaEmision"`
 	B_estado         string `json:"estado"`
+
+	// Dt_fechaEmision en RFC 3339 en la zona del usuario
+	Emision *string `json:"emision"`
 }
 type NewNotificacion struct {
 	T_nombre        string  `json:"nombre"`
@@ -285,6 +306,7 @@ type UserData struct {
 	T_programa         *string `json:"programa"`
 	TM_antelacionNotis *string `json:"antelacionNotis"`
 	N_celular          *string `json:"celular"`
+	T_zonaHoraria      *string `json:"zonaHoraria"`
 }
 
 type ImportSchedule struct {
@@ -306,9 +328,125 @@ type ImportSchedule struct {
 	PeriodoAcademico string  `json:"periodoAcademico"`
 }
 
-type Token struct {
-	UserId string `json:"userId"`
-	Token  string `json:"token"`
+type PasswordResetRequest struct {
+	User string `json:"user"`
+}
+
+type PasswordResetConfirm struct {
+	User    string `json:"user"`
+	Token   string `json:"token"`
+	NewPass string `json:"newPass"`
+}
+
+type TOTPCode struct {
+	Code string `json:"code"`
+}
+
+type TOTPLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type Session struct {
+	ID        string `json:"sessionId"`
+	Device    string `json:"device"`
+	UserAgent string `json:"userAgent"`
+	IP        string `json:"ip"`
+	CreatedAt string `json:"createdAt"`
+	LastSeen  string `json:"lastSeen"`
+	Current   bool   `json:"current"`
+	// Usuario suplantado, si la sesión es de suplantación
+	Impersonating string `json:"impersonating,omitempty"`
+}
+
+type RevokeSession struct {
+	SessionID string `json:"sessionId"`
+}
+
+type RevokeAllSessions struct {
+	ExceptCurrent bool `json:"exceptCurrent"`
+}
+
+type UnlockAccount struct {
+	User string `json:"user"`
+	IP   string `json:"ip"`
+}
+
+type ImpersonateRequest struct {
+	User     string `json:"user"`
+	Minutes  int    `json:"minutes"`
+	Writable bool   `json:"writable"`
+	Reason   string `json:"reason"`
+}
+
+type EnlaceHorarioRequest struct {
+	Scope          string `json:"scope"`
+	ExpiresInHours int    `json:"expiresInHours"`
+	Password       string `json:"password"`
+}
+
+type RevocarEnlaceRequest struct {
+	ID string `json:"id"`
+}
+
+type DisponibilidadRequest struct {
+	CodInvitado string `json:"codInvitado"`
+}
+
+type DiaSinClase struct {
+	N_idDiaSinClase      int    `json:"idDiaSinClase"`
+	N_idPeriodoAcademico int    `json:"idPeriodoAcademico"`
+	Dt_fechaInicio       string `json:"fechaInicio"`
+	Dt_fechaFinal        string `json:"fechaFinal"`
+	T_tipo               string `json:"tipo"`
+	T_motivo             string `json:"motivo"`
+}
+
+type NewDiaSinClase struct {
+	N_idPeriodoAcademico int    `json:"idPeriodoAcademico"`
+	Dt_fechaInicio       string `json:"fechaInicio"`
+	Dt_fechaFinal        string `json:"fechaFinal"`
+	T_tipo               string `json:"tipo"`
+	T_motivo             string `json:"motivo"`
+}
+
+type ExcepcionClase struct {
+	N_idExcepcion        int     `json:"idExcepcion"`
+	N_idPeriodoAcademico int     `json:"idPeriodoAcademico"`
+	T_nrc                string  `json:"nrc"`
+	Dt_fecha             string  `json:"fecha"`
+	T_tipo               string  `json:"tipo"`
+	Dt_nuevaFecha        *string `json:"nuevaFecha"`
+	T_horaInicio         *string `json:"horaInicio"`
+	T_horaFin            *string `json:"horaFin"`
+	T_salon              *string `json:"salon"`
+	T_motivo             string  `json:"motivo"`
+}
+
+type NewExcepcionClase struct {
+	N_idPeriodoAcademico int     `json:"idPeriodoAcademico"`
+	T_nrc                string  `json:"nrc"`
+	Dt_fecha             string  `json:"fecha"`
+	T_tipo               string  `json:"tipo"`
+	Dt_nuevaFecha        *string `json:"nuevaFecha"`
+	T_horaInicio         *string `json:"horaInicio"`
+	T_horaFin            *string `json:"horaFin"`
+	T_salon              *string `json:"salon"`
+	T_motivo             string  `json:"motivo"`
+}
+
+type EliminarExcepcionRequest struct {
+	ID int `json:"id"`
+}
+
+type ZonaHorariaRequest struct {
+	ZonaHoraria string `json:"timezone"`
+}
+
+type UndoRequest struct {
+	CodUsuario *string `json:"codUsuario"`
+	Count      int     `json:"count"`
+	Preview    bool    `json:"preview"`
 }
 
 type DeleteNotification struct {
@@ -327,6 +465,23 @@ type Onboarding struct {
 	Status string `json:"status"`
 }
 
+// Registro de Logs tal como lo devuelve GET /admin/logs
+type LogEntry struct {
+	ID           int64           `json:"id"`
+	Fecha        string          `json:"fecha"`
+	UsuarioID    int             `json:"usuarioId,omitempty"`
+	CodUsuario   string          `json:"codUsuario,omitempty"`
+	Accion       string          `json:"accion"`
+	Descripcion  string          `json:"descripcion"`
+	Actor        string          `json:"actor,omitempty"`
+	TipoObjetivo string          `json:"tipoObjetivo,omitempty"`
+	IDObjetivo   string          `json:"idObjetivo,omitempty"`
+	RequestID    string          `json:"requestId,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	Antes        json.RawMessage `json:"antes,omitempty"`
+	Despues      json.RawMessage `json:"despues,omitempty"`
+}
+
 type Log struct {
 	CodUsuario  *string `json:"codUsuario"`
 	Accion      string  `json:"accion"`
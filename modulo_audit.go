@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ EVENTOS DE AUDITORÍA ------------------------ //
+
+// Acciones que se registran en Logs.T_accion. Se conservan los nombres que ya
+// existían en la tabla para no romper las consultas sobre registros antiguos.
+type AccionAuditoria string
+
+const (
+	// Cuenta y sesiones
+	accionIniciarSesion          AccionAuditoria = "INICIAR_SESION"
+	accionCrearUsuario           AccionAuditoria = "CREAR_USUARIO"
+	accionCrearAdmin             AccionAuditoria = "CREAR_ADMIN"
+	accionCambiarContrasena      AccionAuditoria = "CAMBIAR_CONTRASEÑA"
+	accionSolicitarRestablecer   AccionAuditoria = "SOLICITAR_RESTABLECER_CONTRASEÑA"
+	accionBloqueoCuenta          AccionAuditoria = "BLOQUEO_CUENTA"
+	accionBloqueoIP              AccionAuditoria = "BLOQUEO_IP"
+	accionDesbloqueoCuenta       AccionAuditoria = "DESBLOQUEO_CUENTA"
+	accionRevocarSesion          AccionAuditoria = "REVOCAR_SESION"
+	accionRevocarSesiones        AccionAuditoria = "REVOCAR_SESIONES"
+	accionActivar2FA             AccionAuditoria = "ACTIVAR_2FA"
+	accionDesactivar2FA          AccionAuditoria = "DESACTIVAR_2FA"
+	accionUsarCodigoRecuperacion AccionAuditoria = "USAR_CODIGO_RECUPERACION"
+	accionIniciarSuplantacion    AccionAuditoria = "INICIAR_SUPLANTACION"
+	accionSuplantacion           AccionAuditoria = "SUPLANTACION"
+	accionExportarAuditoria      AccionAuditoria = "EXPORTAR_AUDITORIA"
+	accionArchivarLogs           AccionAuditoria = "ARCHIVAR_LOGS"
+
+	// Datos del usuario
+	accionCrearRecordatorio        AccionAuditoria = "CREAR_RECORDATORIO"
+	accionActualizarRecordatorio   AccionAuditoria = "UPDATE_RECORDATORIO"
+	accionEliminarRecordatorio     AccionAuditoria = "ELIMINAR_RECORDATORIO"
+	accionEliminarRecordatorios    AccionAuditoria = "ELIMINAR_MULTIPLES_RECORDATORIOS"
+	accionEliminarEtiqueta         AccionAuditoria = "ELIMINAR_ETIQUETA"
+	accionCrearComentario          AccionAuditoria = "CREAR_COMENTARIO"
+	accionActualizarComentario     AccionAuditoria = "ACTUALIZAR_COMENTARIO"
+	accionEliminarComentario       AccionAuditoria = "ELIMINAR_COMENTARIO"
+	accionCrearActividadPersonal   AccionAuditoria = "CREAR_ACTIVIDAD_PERSONAL"
+	accionActualizarActividad      AccionAuditoria = "ACTUALIZAR_ACTIVIDAD_PERSONAL"
+	accionEliminarActividad        AccionAuditoria = "ELIMINAR_ACTIVIDAD_PERSONAL"
+	accionDeshacer                 AccionAuditoria = "DESHACER"
+	accionCrearTokenCalendario     AccionAuditoria = "CREAR_TOKEN_CALENDARIO"
+	accionRotarTokenCalendario     AccionAuditoria = "ROTAR_TOKEN_CALENDARIO"
+	accionRevocarTokenCalendario   AccionAuditoria = "REVOCAR_TOKEN_CALENDARIO"
+	accionCompartirDisponibilidad  AccionAuditoria = "COMPARTIR_DISPONIBILIDAD"
+	accionRevocarDisponibilidad    AccionAuditoria = "REVOCAR_DISPONIBILIDAD"
+	accionCrearEnlaceHorario       AccionAuditoria = "CREAR_ENLACE_HORARIO"
+	accionRevocarEnlaceHorario     AccionAuditoria = "REVOCAR_ENLACE_HORARIO"
+	accionCrearNotificacion        AccionAuditoria = "CREAR_NOTIFICACION"
+	accionEliminarNotificaciones   AccionAuditoria = "ELIMINAR_NOTIFICACIONES"
+	accionConfigurarNotificaciones AccionAuditoria = "CONFIGURAR_NOTIFICACIONES"
+	accionCrearCorreo              AccionAuditoria = "CREAR_CORREO"
+	accionGuardarPaleta            AccionAuditoria = "GUARDAR_PALETA"
+	accionGuardarOnboarding        AccionAuditoria = "GUARDAR_ONBOARDING"
+	accionImportarCalendario       AccionAuditoria = "IMPORTAR_CALENDARIO"
+	accionImportarHorario          AccionAuditoria = "IMPORTAR_HORARIO"
+	accionAgregarPeriodoAcademico  AccionAuditoria = "AGREGAR PERIODO ACADEMICO"
+	accionEditarPeriodoAcademico   AccionAuditoria = "EDITAR PERIODO ACADEMICO"
+	accionEliminarPeriodoAcademico AccionAuditoria = "ELIMINAR PERIODO ACADEMICO"
+	accionCrearDiaSinClase         AccionAuditoria = "CREAR_DIA_SIN_CLASE"
+	accionEliminarDiaSinClase      AccionAuditoria = "ELIMINAR_DIA_SIN_CLASE"
+	accionCrearExcepcionClase      AccionAuditoria = "CREAR_EXCEPCION_CLASE"
+	accionEliminarExcepcionClase   AccionAuditoria = "ELIMINAR_EXCEPCION_CLASE"
+	accionConfigurarZonaHoraria    AccionAuditoria = "CONFIGURAR_ZONA_HORARIA"
+)
+
+// Tipos de objeto afectados (Logs.T_tipoObjetivo)
+const (
+	objetivoUsuario         = "usuario"
+	objetivoSesion          = "sesion"
+	objetivoIP              = "ip"
+	objetivoRecordatorio    = "recordatorio"
+	objetivoEtiqueta        = "etiqueta"
+	objetivoComentario      = "comentario"
+	objetivoActividad       = "actividad_personal"
+	objetivoNotificacion    = "notificacion"
+	objetivoCorreo          = "correo"
+	objetivoHorario         = "horario"
+	objetivoPeriodo         = "periodo_academico"
+	objetivoTokenCalendario = "token_calendario"
+	objetivoDisponibilidad  = "disponibilidad"
+	objetivoEnlaceHorario   = "enlace_horario"
+	objetivoDiaSinClase     = "dia_sin_clase"
+	objetivoExcepcionClase  = "excepcion_clase"
+)
+
+// Un registro de auditoría. UsuarioID es el dueño de los datos (Logs.N_idUsuario)
+// y Actor quien hizo la acción, que en una suplantación es el administrador.
+// Si solo se conoce el código del dueño, va en CodUsuario y el escritor resuelve el id.
+type EventoAuditoria struct {
+	UsuarioID    int
+	CodUsuario   string
+	Actor        string
+	Accion       AccionAuditoria
+	TipoObjetivo string
+	IDObjetivo   string
+	RequestID    string
+	IP           string
+	Antes        any
+	Despues      any
+	Descripcion  string
+}
+
+// Arma un evento con los datos de la petición: actor, id de petición e IP.
+// El evento se puede registrar fuera de la petición (p. ej. en una goroutine).
+func nuevoEvento(c *gin.Context, accion AccionAuditoria, tipo string, id string) EventoAuditoria {
+	e := EventoAuditoria{
+		Accion:       accion,
+		TipoObjetivo: tipo,
+		IDObjetivo:   id,
+		RequestID:    c.GetString("request_id"),
+		IP:           c.ClientIP(),
+	}
+
+	if val, ok := c.Get("user_claims"); ok {
+		e.Actor = duenoSesion(val.(*Claims))
+	}
+	return e
+}
+
+// Atajo para los eventos sin instantáneas
+func auditar(c *gin.Context, usuarioID int, accion AccionAuditoria, tipo string, id string, descripcion string) {
+	e := nuevoEvento(c, accion, tipo, id)
+	e.UsuarioID = usuarioID
+	e.Descripcion = descripcion
+	registrarEvento(e)
+}
+
+// Encola el evento para el escritor por lotes; no bloquea la petición.
+// Las eliminaciones que se pueden deshacer se guardan además de inmediato.
+func registrarEvento(e EventoAuditoria) {
+	antes := instantanea(e.Antes)
+	if slices.Contains(accionesDeshacibles, e.Accion) {
+		registrarDeshacible(e, antes)
+	}
+
+	auditoria.encolar(filaAuditoria{
+		UsuarioID:    e.UsuarioID,
+		CodUsuario:   e.CodUsuario,
+		Accion:       string(e.Accion),
+		Descripcion:  e.Descripcion,
+		Fecha:        fechaHoraBD(time.Now()),
+		Actor:        e.Actor,
+		TipoObjetivo: e.TipoObjetivo,
+		IDObjetivo:   e.IDObjetivo,
+		RequestID:    e.RequestID,
+		IP:           e.IP,
+		Antes:        antes,
+		Despues:      instantanea(e.Despues),
+	})
+}
+
+// Serializa el estado de un objeto para J_antes/J_despues
+func instantanea(v any) *string {
+	if v == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error serializando instantánea de auditoría: %v", err)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	texto := string(data)
+	return &texto
+}
+
+func nuloSiCero(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nuloSiVacio(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
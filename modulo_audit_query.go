@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ CONSULTA DE AUDITORÍA ------------------------ //
+
+const (
+	limitePaginaLogs    = 50
+	limiteMaxPaginaLogs = 500
+)
+
+// Columnas en el orden que las lee escanearLog
+const columnasLog = `
+	l.N_idLog, l.N_idUsuario, u.T_codUsuario, l.T_accion, l.T_Descripcion, l.Dt_fecha,
+	l.T_actor, l.T_tipoObjetivo, l.T_idObjetivo, l.T_requestId, l.T_ip, l.J_antes, l.J_despues`
+
+// Arma el WHERE a partir de los filtros de la URL. Devuelve un mensaje si algún filtro es inválido.
+func filtrosLogs(c *gin.Context) (string, []interface{}, string) {
+	var condiciones []string
+	var args []interface{}
+
+	// Las fechas sin desfase se toman en la zona del administrador
+	zona := zonaInstitucion
+	if claims, ok := c.Get("user_claims"); ok {
+		zona = zonaUsuario(claims.(*Claims).UserID)
+	}
+
+	if usuario := c.Query("user"); usuario != "" {
+		condiciones = append(condiciones, "u.T_codUsuario = ?")
+		args = append(args, usuario)
+	}
+
+	// Varias acciones separadas por coma: action=CREAR_RECORDATORIO,IMPORTAR_HORARIO
+	if acciones := c.Query("action"); acciones != "" {
+		lista := strings.Split(acciones, ",")
+		condiciones = append(condiciones, "l.T_accion IN ("+strings.TrimSuffix(strings.Repeat("?,", len(lista)), ",")+")")
+		for _, accion := range lista {
+			args = append(args, strings.TrimSpace(accion))
+		}
+	}
+
+	if actor := c.Query("actor"); actor != "" {
+		condiciones = append(condiciones, "l.T_actor = ?")
+		args = append(args, actor)
+	}
+
+	if tipo := c.Query("targetType"); tipo != "" {
+		condiciones = append(condiciones, "l.T_tipoObjetivo = ?")
+		args = append(args, tipo)
+	}
+
+	if id := c.Query("targetId"); id != "" {
+		condiciones = append(condiciones, "l.T_idObjetivo = ?")
+		args = append(args, id)
+	}
+
+	if desde := c.Query("from"); desde != "" {
+		t, _, err := leerFechaFiltro(desde, zona)
+		if err != nil {
+			return "", nil, "from debe ser YYYY-MM-DD o RFC3339"
+		}
+		condiciones = append(condiciones, "l.Dt_fecha >= ?")
+		args = append(args, fechaHoraBD(t))
+	}
+
+	if hasta := c.Query("to"); hasta != "" {
+		t, soloFecha, err := leerFechaFiltro(hasta, zona)
+		if err != nil {
+			return "", nil, "to debe ser YYYY-MM-DD o RFC3339"
+		}
+		// Con solo la fecha se incluye el día completo
+		if soloFecha {
+			t = t.AddDate(0, 0, 1)
+		}
+		condiciones = append(condiciones, "l.Dt_fecha < ?")
+		args = append(args, fechaHoraBD(t))
+	}
+
+	// Texto libre sobre la descripción
+	if q := c.Query("q"); q != "" {
+		escapado := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+		condiciones = append(condiciones, "l.T_Descripcion LIKE ?")
+		args = append(args, "%"+escapado+"%")
+	}
+
+	if len(condiciones) == 0 {
+		return "", args, ""
+	}
+	return " WHERE " + strings.Join(condiciones, " AND "), args, ""
+}
+
+// Instante del filtro en zonaInstitucion, que es la hora local de Logs.Dt_fecha.
+// Un RFC 3339 respeta su desfase; una fecha sola es medianoche en la zona del administrador.
+func leerFechaFiltro(valor string, zona *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, valor, zona); err == nil {
+		return t.In(zonaInstitucion), true, nil
+	}
+	t, err := time.Parse(time.RFC3339, valor)
+	return t.In(zonaInstitucion), false, err
+}
+
+// El cursor es el N_idLog del último registro de la página anterior
+func codificarCursorLogs(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodificarCursorLogs(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func escanearLog(rows *sql.Rows) (LogEntry, error) {
+	var entrada LogEntry
+	var usuarioID sql.NullInt64
+	var codUsuario, descripcion, actor, tipo, id, requestID, ip, antes, despues sql.NullString
+
+	err := rows.Scan(
+		&entrada.ID,
+		&usuarioID,
+		&codUsuario,
+		&entrada.Accion,
+		&descripcion,
+		&entrada.Fecha,
+		&actor,
+		&tipo,
+		&id,
+		&requestID,
+		&ip,
+		&antes,
+		&despues,
+	)
+	if err != nil {
+		return entrada, err
+	}
+
+	// Dt_fecha es hora local de la institución; se devuelve como instante RFC 3339
+	if fecha := rfc3339BD(entrada.Fecha, zonaInstitucion); fecha != nil {
+		entrada.Fecha = *fecha
+	}
+	entrada.UsuarioID = int(usuarioID.Int64)
+	entrada.CodUsuario = codUsuario.String
+	entrada.Descripcion = descripcion.String
+	entrada.Actor = actor.String
+	entrada.TipoObjetivo = tipo.String
+	entrada.IDObjetivo = id.String
+	entrada.RequestID = requestID.String
+	entrada.IP = ip.String
+	if antes.Valid {
+		entrada.Antes = json.RawMessage(antes.String)
+	}
+	if despues.Valid {
+		entrada.Despues = json.RawMessage(despues.String)
+	}
+	return entrada, nil
+}
+
+// Búsqueda de registros para administradores.
+// format=json (por defecto, paginado con cursor), csv o ndjson (exportación completa).
+func getAuditLogs(c *gin.Context) {
+	where, args, msg := filtrosLogs(c)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	formato := c.DefaultQuery("format", "json")
+	switch formato {
+	case "json":
+		paginaLogs(c, where, args)
+	case "csv", "ndjson":
+		exportarLogs(c, formato, where, args)
+	default:
+		c.JSON(400, gin.H{"error": "format debe ser json, csv o ndjson"})
+	}
+}
+
+func paginaLogs(c *gin.Context, where string, args []interface{}) {
+	limite := limitePaginaLogs
+	if valor := c.Query("limit"); valor != "" {
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 1 || n > limiteMaxPaginaLogs {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("limit debe estar entre 1 y %d", limiteMaxPaginaLogs)})
+			return
+		}
+		limite = n
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		desdeID, err := decodificarCursorLogs(cursor)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "cursor inválido"})
+			return
+		}
+		if where == "" {
+			where = " WHERE l.N_idLog < ?"
+		} else {
+			where += " AND l.N_idLog < ?"
+		}
+		args = append(args, desdeID)
+	}
+
+	// Se pide un registro de más para saber si hay otra página
+	rows, err := db.Query(
+		"SELECT "+columnasLog+" FROM Logs l LEFT JOIN Usuarios u ON u.N_idUsuario = l.N_idUsuario"+
+			where+" ORDER BY l.N_idLog DESC LIMIT ?",
+		append(args, limite+1)...,
+	)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer rows.Close()
+
+	entradas := []LogEntry{}
+	for rows.Next() {
+		entrada, err := escanearLog(rows)
+		if err != nil {
+			log.Printf("Scan error: %v", err)
+			c.JSON(500, gin.H{"error": "Error en procesamiento de datos"})
+			return
+		}
+		entradas = append(entradas, entrada)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Rows error: %v", err)
+		c.JSON(500, gin.H{"error": "Error leyendo resultados"})
+		return
+	}
+
+	var siguiente string
+	if len(entradas) > limite {
+		entradas = entradas[:limite]
+		siguiente = codificarCursorLogs(entradas[limite-1].ID)
+	}
+
+	c.JSON(200, gin.H{
+		"items":      entradas,
+		"nextCursor": siguiente,
+	})
+}
+
+// Exporta todos los registros que cumplen los filtros, fila por fila
+func exportarLogs(c *gin.Context, formato string, where string, args []interface{}) {
+	rows, err := db.Query(
+		"SELECT "+columnasLog+" FROM Logs l LEFT JOIN Usuarios u ON u.N_idUsuario = l.N_idUsuario"+
+			where+" ORDER BY l.N_idLog DESC",
+		args...,
+	)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer rows.Close()
+
+	// La exportación también queda auditada
+	admin := c.MustGet("user_claims").(*Claims)
+	descripcion := fmt.Sprintf("Exportación de logs | Admin: %s | Formato: %s | Filtros: %s",
+		admin.UserID, formato, c.Request.URL.RawQuery)
+	auditar(c, idUsuarioPorCodigo(admin.UserID), accionExportarAuditoria, "", "", descripcion)
+
+	nombre := "logs-" + time.Now().Format("20060102-150405") + "." + formato
+	c.Header("Content-Disposition", `attachment; filename="`+nombre+`"`)
+
+	var escribir func(LogEntry) error
+	var terminar func() error
+
+	if formato == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{
+			"id", "fecha", "usuarioId", "codUsuario", "accion", "descripcion", "actor",
+			"tipoObjetivo", "idObjetivo", "requestId", "ip", "antes", "despues",
+		})
+		escribir = func(e LogEntry) error {
+			return w.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.Fecha, strconv.Itoa(e.UsuarioID), e.CodUsuario,
+				e.Accion, e.Descripcion, e.Actor, e.TipoObjetivo, e.IDObjetivo, e.RequestID, e.IP,
+				string(e.Antes), string(e.Despues),
+			})
+		}
+		terminar = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		escribir = func(e LogEntry) error { return enc.Encode(e) }
+		terminar = func() error { return nil }
+	}
+	c.Status(200)
+
+	// Ya se enviaron las cabeceras: un error a mitad de camino solo se puede registrar
+	for rows.Next() {
+		entrada, err := escanearLog(rows)
+		if err != nil {
+			log.Printf("Scan error: %v", err)
+			return
+		}
+		if err := escribir(entrada); err != nil {
+			log.Printf("Error escribiendo exportación: %v", err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Rows error: %v", err)
+	}
+	if err := terminar(); err != nil {
+		log.Printf("Error escribiendo exportación: %v", err)
+	}
+}
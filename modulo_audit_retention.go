@@ -0,0 +1,397 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ RETENCIÓN DE LOGS ------------------------ //
+
+// Política por defecto, incluida en el binario igual que la de permisos
+//
+//go:embed config/retention.json
+var retencionPorDefecto []byte
+
+// Días que se conserva cada acción en Logs antes de archivarse
+type PoliticaRetencion struct {
+	DiasPorDefecto int            `json:"diasPorDefecto"`
+	Acciones       map[string]int `json:"acciones"`
+}
+
+type configRetencion struct {
+	politica   PoliticaRetencion
+	modo       string // "table" (Logs_Archivo) o "file" (NDJSON comprimido)
+	directorio string
+	intervalo  time.Duration
+	lote       int
+}
+
+var retencionCfg configRetencion
+
+const (
+	claveBloqueoRetencion = "lock:retencion-logs"
+	claveEstadoRetencion  = "retencion:estado"
+	duracionBloqueo       = time.Hour
+)
+
+// Carga la política desde RETENTION_FILE, o la embebida si no se configuró
+func leerConfigRetencion() configRetencion {
+	data := retencionPorDefecto
+
+	if ruta := os.Getenv("RETENTION_FILE"); ruta != "" {
+		contenido, err := os.ReadFile(ruta)
+		if err != nil {
+			log.Fatalf("No se pudo leer la política de retención %s: %v", ruta, err)
+		}
+		data = contenido
+	}
+
+	var politica PoliticaRetencion
+	if err := json.Unmarshal(data, &politica); err != nil {
+		log.Fatalf("Política de retención inválida: %v", err)
+	}
+	if politica.DiasPorDefecto <= 0 {
+		log.Fatalf("Política de retención inválida: diasPorDefecto debe ser mayor que 0")
+	}
+	for accion, dias := range politica.Acciones {
+		if dias <= 0 {
+			log.Fatalf("Política de retención inválida: los días de %s deben ser mayores que 0", accion)
+		}
+	}
+
+	cfg := configRetencion{
+		politica:   politica,
+		modo:       os.Getenv("AUDIT_ARCHIVE"),
+		directorio: os.Getenv("AUDIT_ARCHIVE_DIR"),
+		intervalo:  envDuration("AUDIT_RETENTION_INTERVAL", 24*time.Hour),
+		lote:       envInt("AUDIT_RETENTION_BATCH", 1000),
+	}
+	if cfg.modo == "" {
+		cfg.modo = "table"
+	}
+	if cfg.modo != "table" && cfg.modo != "file" {
+		log.Fatalf("AUDIT_ARCHIVE debe ser table o file")
+	}
+	if cfg.directorio == "" {
+		cfg.directorio = "archive"
+	}
+	return cfg
+}
+
+// Una regla por acción con días propios y una más para el resto
+type reglaRetencion struct {
+	accion string // vacío = todas las demás
+	dias   int
+}
+
+func (cfg configRetencion) reglas() []reglaRetencion {
+	var reglas []reglaRetencion
+	for accion, dias := range cfg.politica.Acciones {
+		reglas = append(reglas, reglaRetencion{accion: accion, dias: dias})
+	}
+	slices.SortFunc(reglas, func(a, b reglaRetencion) int { return strings.Compare(a.accion, b.accion) })
+	return append(reglas, reglaRetencion{dias: cfg.politica.DiasPorDefecto})
+}
+
+// WHERE de las filas vencidas para una regla
+func (cfg configRetencion) filtroVencidos(r reglaRetencion) (string, []interface{}) {
+	limite := fechaHoraBD(time.Now().AddDate(0, 0, -r.dias))
+
+	if r.accion != "" {
+		return "l.T_accion = ? AND l.Dt_fecha < ?", []interface{}{r.accion, limite}
+	}
+
+	if len(cfg.politica.Acciones) == 0 {
+		return "l.Dt_fecha < ?", []interface{}{limite}
+	}
+	var args []interface{}
+	for accion := range cfg.politica.Acciones {
+		args = append(args, accion)
+	}
+	marcas := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	return "l.T_accion NOT IN (" + marcas + ") AND l.Dt_fecha < ?", append(args, limite)
+}
+
+// Corre el job cada AUDIT_RETENTION_INTERVAL. Todas las instancias lo intentan,
+// pero solo la que toma el bloqueo en Redis hace el trabajo.
+func iniciarRetencionLogs() {
+	go func() {
+		// Primera ejecución poco después de arrancar
+		time.Sleep(time.Minute)
+		for {
+			ejecutarRetencion()
+			time.Sleep(retencionCfg.intervalo)
+		}
+	}()
+}
+
+func ejecutarRetencion() {
+	token := make([]byte, 16)
+	rand.Read(token)
+	instancia := hex.EncodeToString(token)
+
+	tomado, err := rdb.SetNX(ctx, claveBloqueoRetencion, instancia, duracionBloqueo).Result()
+	if err != nil {
+		log.Printf("Error de Redis tomando el bloqueo de retención: %v", err)
+		return
+	}
+	if !tomado {
+		return
+	}
+	defer liberarBloqueoRetencion(instancia)
+
+	inicio := time.Now()
+	total := 0
+	var errJob error
+
+	for _, regla := range retencionCfg.reglas() {
+		n, err := archivarRegla(regla, instancia)
+		total += n
+		if err != nil {
+			errJob = err
+			break
+		}
+	}
+
+	estado := map[string]any{
+		"ultimaEjecucion": inicio.UTC().Format(time.RFC3339),
+		"duracion":        time.Since(inicio).Round(time.Millisecond).String(),
+		"archivados":      total,
+		"modo":            retencionCfg.modo,
+		"error":           "",
+	}
+	if errJob != nil {
+		log.Printf("Error en la retención de logs: %v", errJob)
+		estado["error"] = errJob.Error()
+	}
+	if err := rdb.HSet(ctx, claveEstadoRetencion, estado).Err(); err != nil {
+		log.Printf("Error de Redis guardando estado de retención: %v", err)
+	}
+
+	if total > 0 {
+		insertarLog(0, string(accionArchivarLogs),
+			fmt.Sprintf("Retención de logs | Archivados: %d | Modo: %s | Duración: %v", total, retencionCfg.modo, time.Since(inicio).Round(time.Second)))
+	}
+}
+
+// Solo se borra el bloqueo si sigue siendo de esta instancia
+func liberarBloqueoRetencion(instancia string) {
+	const script = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+	if err := rdb.Eval(ctx, script, []string{claveBloqueoRetencion}, instancia).Err(); err != nil {
+		log.Printf("Error de Redis liberando el bloqueo de retención: %v", err)
+	}
+}
+
+// Extiende el bloqueo mientras esta instancia siga siendo la dueña. Si ya no lo es
+// (el bloqueo venció y lo tomó otra), el job se detiene para no trabajar en paralelo.
+func renovarBloqueoRetencion(instancia string) error {
+	const script = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+	renovado, err := rdb.Eval(ctx, script, []string{claveBloqueoRetencion}, instancia, duracionBloqueo.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if renovado == 0 {
+		return fmt.Errorf("se perdió el bloqueo de retención")
+	}
+	return nil
+}
+
+// Mueve por lotes las filas vencidas de una regla. El bloqueo se renueva antes de
+// cada lote, así una ejecución larga no se cruza con otra instancia.
+func archivarRegla(r reglaRetencion, instancia string) (int, error) {
+	filtro, args := retencionCfg.filtroVencidos(r)
+	total := 0
+
+	for {
+		if err := renovarBloqueoRetencion(instancia); err != nil {
+			return total, err
+		}
+
+		rows, err := db.Query(
+			"SELECT "+columnasLog+" FROM Logs l LEFT JOIN Usuarios u ON u.N_idUsuario = l.N_idUsuario WHERE "+
+				filtro+" ORDER BY l.N_idLog LIMIT ?",
+			append(slices.Clone(args), retencionCfg.lote)...,
+		)
+		if err != nil {
+			return total, err
+		}
+
+		var entradas []LogEntry
+		for rows.Next() {
+			entrada, err := escanearLog(rows)
+			if err != nil {
+				rows.Close()
+				return total, err
+			}
+			entradas = append(entradas, entrada)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+
+		if len(entradas) == 0 {
+			return total, nil
+		}
+
+		if retencionCfg.modo == "file" {
+			err = archivarEnArchivo(entradas)
+		} else {
+			err = archivarEnTabla(entradas)
+		}
+		if err != nil {
+			return total, err
+		}
+		total += len(entradas)
+
+		if len(entradas) < retencionCfg.lote {
+			return total, nil
+		}
+	}
+}
+
+func idsDeLogs(entradas []LogEntry) (string, []interface{}) {
+	args := make([]interface{}, len(entradas))
+	for i, e := range entradas {
+		args[i] = e.ID
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(args)), ","), args
+}
+
+// Copia a Logs_Archivo y borra de Logs en la misma transacción
+func archivarEnTabla(entradas []LogEntry) error {
+	marcas, args := idsDeLogs(entradas)
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO Logs_Archivo SELECT * FROM Logs WHERE N_idLog IN ("+marcas+")", args...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM Logs WHERE N_idLog IN ("+marcas+")", args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Escribe un archivo NDJSON comprimido por lote y luego borra las filas.
+// Si el borrado falla, las filas quedan en Logs y se vuelven a archivar en la siguiente ejecución.
+func archivarEnArchivo(entradas []LogEntry) error {
+	if err := os.MkdirAll(retencionCfg.directorio, 0o750); err != nil {
+		return err
+	}
+
+	nombre := fmt.Sprintf("logs-%s-%d-%d.ndjson.gz",
+		time.Now().Format("20060102-150405"), entradas[0].ID, entradas[len(entradas)-1].ID)
+	ruta := filepath.Join(retencionCfg.directorio, nombre)
+
+	archivo, err := os.OpenFile(ruta, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(archivo)
+	enc := json.NewEncoder(gz)
+	for _, e := range entradas {
+		if err := enc.Encode(e); err != nil {
+			archivo.Close()
+			os.Remove(ruta)
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		archivo.Close()
+		os.Remove(ruta)
+		return err
+	}
+	if err := archivo.Close(); err != nil {
+		os.Remove(ruta)
+		return err
+	}
+
+	marcas, args := idsDeLogs(entradas)
+	_, err = db.Exec("DELETE FROM Logs WHERE N_idLog IN ("+marcas+")", args...)
+	return err
+}
+
+// Estado de la retención: política, última ejecución y filas pendientes por regla
+func getRetentionStatus(c *gin.Context) {
+	ultima, err := rdb.HGetAll(c.Request.Context(), claveEstadoRetencion).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	reglas := []gin.H{}
+	for _, regla := range retencionCfg.reglas() {
+		filtro, args := retencionCfg.filtroVencidos(regla)
+
+		var pendientes int
+		if err := db.QueryRow("SELECT COUNT(*) FROM Logs l WHERE "+filtro, args...).Scan(&pendientes); err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		accion := regla.accion
+		if accion == "" {
+			accion = "*"
+		}
+		reglas = append(reglas, gin.H{
+			"accion":     accion,
+			"dias":       regla.dias,
+			"pendientes": pendientes,
+		})
+	}
+
+	var masAntiguo *string
+	if err := db.QueryRow("SELECT MIN(Dt_fecha) FROM Logs").Scan(&masAntiguo); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	enCurso, _ := rdb.Exists(c.Request.Context(), claveBloqueoRetencion).Result()
+
+	respuesta := gin.H{
+		"modo":            retencionCfg.modo,
+		"intervalo":       retencionCfg.intervalo.String(),
+		"enCurso":         enCurso > 0,
+		"logMasAntiguo":   masAntiguo,
+		"reglas":          reglas,
+		"ultimaEjecucion": nil,
+	}
+	if len(ultima) > 0 {
+		archivados, _ := strconv.Atoi(ultima["archivados"])
+		respuesta["ultimaEjecucion"] = gin.H{
+			"fecha":      ultima["ultimaEjecucion"],
+			"duracion":   ultima["duracion"],
+			"archivados": archivados,
+			"modo":       ultima["modo"],
+			"error":      ultima["error"],
+		}
+	}
+	if retencionCfg.modo == "file" {
+		respuesta["directorio"] = retencionCfg.directorio
+	}
+
+	c.JSON(200, respuesta)
+}
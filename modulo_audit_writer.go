@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//	------------------------ ESCRITOR DE AUDITORÍA ------------------------ //
+
+// Fila lista para insertar en Logs. Las instantáneas ya van serializadas para
+// poder guardarla tal cual en el archivo de respaldo.
+type filaAuditoria struct {
+	UsuarioID    int     `json:"usuarioId,omitempty"`
+	CodUsuario   string  `json:"codUsuario,omitempty"`
+	Accion       string  `json:"accion"`
+	Descripcion  string  `json:"descripcion"`
+	Fecha        string  `json:"fecha"`
+	Actor        string  `json:"actor,omitempty"`
+	TipoObjetivo string  `json:"tipoObjetivo,omitempty"`
+	IDObjetivo   string  `json:"idObjetivo,omitempty"`
+	RequestID    string  `json:"requestId,omitempty"`
+	IP           string  `json:"ip,omitempty"`
+	Antes        *string `json:"antes,omitempty"`
+	Despues      *string `json:"despues,omitempty"`
+}
+
+// Fila que MySQL rechazó por su contenido, con el motivo, para el archivo de descartados
+type filaDescartada struct {
+	filaAuditoria
+	Error string `json:"error"`
+}
+
+// Los eventos se encolan sin bloquear la petición y una sola goroutine los
+// inserta por lotes. Si MySQL no responde después de los reintentos, el lote
+// se guarda en un archivo NDJSON que se vuelve a procesar cuando MySQL vuelve.
+// Las filas que MySQL rechaza por su contenido van a otro archivo y no se reintentan.
+type escritorAuditoria struct {
+	cola            chan filaAuditoria
+	tamLote         int
+	intervalo       time.Duration
+	reintentos      int
+	rutaRespaldo    string
+	rutaDescartados string
+
+	muCierre sync.RWMutex
+	cerrado  bool
+	listo    chan struct{}
+
+	muRespaldo sync.Mutex
+	ultimoOK   bool
+}
+
+var auditoria *escritorAuditoria
+
+func nuevoEscritorAuditoria() *escritorAuditoria {
+	e := &escritorAuditoria{
+		cola:            make(chan filaAuditoria, envInt("AUDIT_BUFFER", 1000)),
+		tamLote:         envInt("AUDIT_BATCH_SIZE", 100),
+		intervalo:       envDuration("AUDIT_FLUSH_INTERVAL", 2*time.Second),
+		reintentos:      envInt("AUDIT_RETRIES", 3),
+		rutaRespaldo:    os.Getenv("AUDIT_SPILL_FILE"),
+		rutaDescartados: os.Getenv("AUDIT_DEAD_LETTER_FILE"),
+		listo:           make(chan struct{}),
+		ultimoOK:        true,
+	}
+	if e.rutaRespaldo == "" {
+		e.rutaRespaldo = "audit-spill.ndjson"
+	}
+	if e.rutaDescartados == "" {
+		e.rutaDescartados = "audit-dead-letter.ndjson"
+	}
+
+	go e.ejecutar()
+	return e
+}
+
+// Nunca bloquea: si la cola está llena o el escritor ya se cerró, la fila va al respaldo
+func (e *escritorAuditoria) encolar(f filaAuditoria) {
+	e.muCierre.RLock()
+	defer e.muCierre.RUnlock()
+
+	if !e.cerrado {
+		select {
+		case e.cola <- f:
+			return
+		default:
+			log.Printf("Cola de auditoría llena, se usa el respaldo en disco")
+		}
+	}
+	e.guardarRespaldo([]filaAuditoria{f})
+}
+
+// Vacía la cola y espera el último lote (se llama al apagar el servidor)
+func (e *escritorAuditoria) cerrar(espera time.Duration) {
+	e.muCierre.Lock()
+	if !e.cerrado {
+		e.cerrado = true
+		close(e.cola)
+	}
+	e.muCierre.Unlock()
+
+	select {
+	case <-e.listo:
+	case <-time.After(espera):
+		log.Printf("El escritor de auditoría no terminó en %v", espera)
+	}
+}
+
+func (e *escritorAuditoria) ejecutar() {
+	defer close(e.listo)
+
+	ticker := time.NewTicker(e.intervalo)
+	defer ticker.Stop()
+
+	// Lo que quedó en disco de una ejecución anterior
+	e.reprocesarRespaldo()
+
+	lote := make([]filaAuditoria, 0, e.tamLote)
+	for {
+		select {
+		case f, ok := <-e.cola:
+			if !ok {
+				e.escribirLote(lote)
+				return
+			}
+			lote = append(lote, f)
+			if len(lote) >= e.tamLote {
+				e.escribirLote(lote)
+				lote = lote[:0]
+			}
+
+		case <-ticker.C:
+			if len(lote) > 0 {
+				e.escribirLote(lote)
+				lote = lote[:0]
+			}
+			if e.ultimoOK {
+				e.reprocesarRespaldo()
+			}
+		}
+	}
+}
+
+func (e *escritorAuditoria) escribirLote(lote []filaAuditoria) {
+	if len(lote) == 0 {
+		return
+	}
+
+	pendientes := lote
+	var err error
+	for intento := 0; intento <= e.reintentos; intento++ {
+		if intento > 0 {
+			time.Sleep(200 * time.Millisecond << (intento - 1))
+		}
+		if pendientes, err = e.insertar(pendientes); err == nil {
+			e.ultimoOK = true
+			return
+		}
+	}
+
+	log.Printf("Error al insertar %d logs, se guardan en %s: %v", len(pendientes), e.rutaRespaldo, err)
+	e.ultimoOK = false
+	e.guardarRespaldo(pendientes)
+}
+
+// Inserta el lote en un solo INSERT. Si MySQL rechaza el contenido de alguna fila,
+// se insertan una por una para no perder las demás y las rechazadas se descartan.
+// Devuelve las filas que fallaron por un error temporal, para reintentarlas.
+func (e *escritorAuditoria) insertar(filas []filaAuditoria) ([]filaAuditoria, error) {
+	err := insertarFilasAuditoria(filas)
+	if err == nil {
+		return nil, nil
+	}
+	if !errorPermanenteMySQL(err) {
+		return filas, err
+	}
+
+	var pendientes []filaAuditoria
+	var errTemporal error
+	for _, f := range filas {
+		err := insertarFilasAuditoria([]filaAuditoria{f})
+		switch {
+		case err == nil:
+		case errorPermanenteMySQL(err):
+			log.Printf("Log rechazado por MySQL, se guarda en %s: %v", e.rutaDescartados, err)
+			e.guardarDescartada(f, err)
+		default:
+			pendientes = append(pendientes, f)
+			errTemporal = err
+		}
+	}
+	return pendientes, errTemporal
+}
+
+// Errores de MySQL por el contenido de la fila; reintentarlos da el mismo resultado
+func errorPermanenteMySQL(err error) bool {
+	var errMySQL *mysql.MySQLError
+	if !errors.As(err, &errMySQL) {
+		return false
+	}
+	switch errMySQL.Number {
+	case 1048, // columna que no admite NULL
+		1264, // valor fuera de rango
+		1292, // fecha inválida
+		1366, // valor incorrecto para la columna
+		1406, // texto más largo que la columna
+		1452, // llave foránea inexistente
+		3140: // JSON inválido
+		return true
+	}
+	return false
+}
+
+func (e *escritorAuditoria) guardarRespaldo(filas []filaAuditoria) {
+	valores := make([]any, len(filas))
+	for i, f := range filas {
+		valores[i] = f
+	}
+	e.anexarNDJSON(e.rutaRespaldo, valores)
+}
+
+func (e *escritorAuditoria) guardarDescartada(f filaAuditoria, err error) {
+	e.anexarNDJSON(e.rutaDescartados, []any{filaDescartada{filaAuditoria: f, Error: err.Error()}})
+}
+
+func (e *escritorAuditoria) anexarNDJSON(ruta string, valores []any) {
+	e.muRespaldo.Lock()
+	defer e.muRespaldo.Unlock()
+
+	archivo, err := os.OpenFile(ruta, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("No se pudo abrir %s: %v", ruta, err)
+		return
+	}
+	defer archivo.Close()
+
+	enc := json.NewEncoder(archivo)
+	for _, v := range valores {
+		if err := enc.Encode(v); err != nil {
+			log.Printf("No se pudo escribir en %s: %v", ruta, err)
+			return
+		}
+	}
+}
+
+// Inserta lo que haya en el archivo de respaldo. Se renombra antes de leerlo
+// para que las filas nuevas que lleguen mientras tanto vayan a un archivo aparte.
+func (e *escritorAuditoria) reprocesarRespaldo() {
+	enProceso := e.rutaRespaldo + ".reproceso"
+
+	e.muRespaldo.Lock()
+	if _, err := os.Stat(enProceso); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(e.rutaRespaldo, enProceso); err != nil {
+			e.muRespaldo.Unlock()
+			return
+		}
+	}
+	e.muRespaldo.Unlock()
+
+	archivo, err := os.Open(enProceso)
+	if err != nil {
+		log.Printf("No se pudo leer el respaldo de auditoría: %v", err)
+		return
+	}
+
+	var filas []filaAuditoria
+	lector := bufio.NewScanner(archivo)
+	lector.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lector.Scan() {
+		var f filaAuditoria
+		if err := json.Unmarshal(lector.Bytes(), &f); err != nil {
+			log.Printf("Línea inválida en el respaldo de auditoría: %v", err)
+			continue
+		}
+		filas = append(filas, f)
+	}
+	archivo.Close()
+
+	for inicio := 0; inicio < len(filas); inicio += e.tamLote {
+		fin := min(inicio+e.tamLote, len(filas))
+		if pendientes, err := e.insertar(filas[inicio:fin]); err != nil {
+			// MySQL sigue caído: lo pendiente vuelve al respaldo
+			log.Printf("No se pudo reprocesar el respaldo de auditoría: %v", err)
+			e.ultimoOK = false
+			e.guardarRespaldo(append(pendientes, filas[fin:]...))
+			break
+		}
+	}
+
+	if err := os.Remove(enProceso); err != nil {
+		log.Printf("No se pudo borrar el respaldo procesado: %v", err)
+	}
+	if len(filas) > 0 && e.ultimoOK {
+		log.Printf("Se reprocesaron %d logs del respaldo", len(filas))
+	}
+}
+
+// Anchos de las columnas de migrations/002_logs_auditoria.sql
+const (
+	anchoActor      = 64
+	anchoIDObjetivo = 255
+	anchoRequestID  = 64
+)
+
+// Recorta a n caracteres (VARCHAR cuenta caracteres, no bytes)
+func recortarTexto(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// Un solo INSERT con todas las filas del lote
+func insertarFilasAuditoria(filas []filaAuditoria) error {
+	valores := make([]string, len(filas))
+	args := make([]interface{}, 0, len(filas)*12)
+
+	for i, f := range filas {
+		if f.UsuarioID == 0 && f.CodUsuario != "" {
+			f.UsuarioID = idUsuarioPorCodigo(f.CodUsuario)
+		}
+
+		valores[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args,
+			nuloSiCero(f.UsuarioID),
+			f.Accion,
+			f.Descripcion,
+			f.Fecha,
+			nuloSiVacio(recortarTexto(f.Actor, anchoActor)),
+			nuloSiVacio(f.TipoObjetivo),
+			nuloSiVacio(recortarTexto(f.IDObjetivo, anchoIDObjetivo)),
+			nuloSiVacio(recortarTexto(f.RequestID, anchoRequestID)),
+			nuloSiVacio(f.IP),
+			f.Antes,
+			f.Despues,
+		)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO Logs (N_idUsuario, T_accion, T_Descripcion, Dt_fecha,
+			T_actor, T_tipoObjetivo, T_idObjetivo, T_requestId, T_ip, J_antes, J_despues)
+		VALUES `+strings.Join(valores, ", "),
+		args...,
+	)
+	return err
+}
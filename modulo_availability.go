@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ DISPONIBILIDAD COMPARTIDA ------------------------ //
+
+// Un usuario autoriza a otro a ver cuándo está ocupado, nunca qué está haciendo:
+//   disponibilidad:otorgada:<codUsuario>  -> códigos a los que se la compartió
+//   disponibilidad:recibida:<codUsuario>  -> códigos que se la compartieron
+
+const maxUsuariosDisponibilidad = 10
+
+type BloqueOcupado struct {
+	Fecha      string `json:"fecha"`
+	Dia        int    `json:"dia"`
+	HoraInicio string `json:"horaInicio"`
+	HoraFin    string `json:"horaFin"`
+}
+
+// Con quién comparte el usuario su disponibilidad y quién se la comparte a él
+func getAvailabilityGrants(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	otorgada, err := rdb.SMembers(c.Request.Context(), "disponibilidad:otorgada:"+claims.UserID).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	recibida, err := rdb.SMembers(c.Request.Context(), "disponibilidad:recibida:"+claims.UserID).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	slices.Sort(otorgada)
+	slices.Sort(recibida)
+
+	c.JSON(200, gin.H{
+		"granted":  otorgada,
+		"received": recibida,
+	})
+}
+
+func grantAvailability(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req DisponibilidadRequest
+	if err := c.BindJSON(&req); err != nil || req.CodInvitado == "" {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	if req.CodInvitado == claims.UserID {
+		c.JSON(400, gin.H{"error": "No puede compartir la disponibilidad consigo mismo"})
+		return
+	}
+	if idUsuarioPorCodigo(req.CodInvitado) == 0 {
+		c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.SAdd(c.Request.Context(), "disponibilidad:otorgada:"+claims.UserID, req.CodInvitado)
+	pipe.SAdd(c.Request.Context(), "disponibilidad:recibida:"+req.CodInvitado, claims.UserID)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionCompartirDisponibilidad, objetivoDisponibilidad, req.CodInvitado,
+		"Se compartió la disponibilidad | Usuario: "+claims.UserID+" | Con: "+req.CodInvitado)
+
+	c.JSON(200, gin.H{"message": "Disponibilidad compartida con " + req.CodInvitado})
+}
+
+func revokeAvailability(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req DisponibilidadRequest
+	if err := c.BindJSON(&req); err != nil || req.CodInvitado == "" {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+
+	pipe := rdb.TxPipeline()
+	quitados := pipe.SRem(c.Request.Context(), "disponibilidad:otorgada:"+claims.UserID, req.CodInvitado)
+	pipe.SRem(c.Request.Context(), "disponibilidad:recibida:"+req.CodInvitado, claims.UserID)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if quitados.Val() == 0 {
+		c.JSON(404, gin.H{"error": "No comparte la disponibilidad con ese usuario"})
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionRevocarDisponibilidad, objetivoDisponibilidad, req.CodInvitado,
+		"Se dejó de compartir la disponibilidad | Usuario: "+claims.UserID+" | Con: "+req.CodInvitado)
+
+	c.JSON(200, gin.H{"message": "Ya no comparte la disponibilidad con " + req.CodInvitado})
+}
+
+// Usuarios de la lista que no le han compartido su disponibilidad al solicitante
+func sinPermisoDisponibilidad(c *gin.Context, solicitante string, usuarios []string) ([]string, error) {
+	var faltan []string
+	for _, cod := range usuarios {
+		if cod == solicitante {
+			continue
+		}
+		ok, err := rdb.SIsMember(c.Request.Context(), "disponibilidad:otorgada:"+cod, solicitante).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			faltan = append(faltan, cod)
+		}
+	}
+	return faltan, nil
+}
+
+// Bloques ocupados de otro usuario entre from y to, sin nombres ni detalles
+func getUserBusy(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+	codUsuario := c.Param("id")
+
+	desde, hasta, msg := leerRangoFechas(c, rangoLibres, rangoMaxLibres)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	faltan, err := sinPermisoDisponibilidad(c, claims.UserID, []string{codUsuario})
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if len(faltan) > 0 {
+		c.JSON(403, gin.H{"error": "El usuario no le ha compartido su disponibilidad"})
+		return
+	}
+
+	bloques, err := bloquesUsuario(codUsuario)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	ocupado := []BloqueOcupado{}
+	for fecha := desde; !fecha.After(hasta); fecha = fecha.AddDate(0, 0, 1) {
+		for _, o := range unirIntervalos(ocupadosEn(bloques, fecha)) {
+			ocupado = append(ocupado, BloqueOcupado{
+				Fecha:      fecha.Format(time.DateOnly),
+				Dia:        diaHorario(fecha.Weekday()),
+				HoraInicio: formatoHora(o.inicio.Sub(fecha)),
+				HoraFin:    formatoHora(o.fin.Sub(fecha)),
+			})
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"user": codUsuario,
+		"from": desde.Format(time.DateOnly),
+		"to":   hasta.Format(time.DateOnly),
+		"busy": ocupado,
+	})
+}
+
+// Franjas en que el solicitante y todos los usuarios de users están libres.
+// Acepta los mismos parámetros que /schedules/users/:id/free-slots.
+func getCommonFreeSlots(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	usuarios := []string{claims.UserID}
+	for _, cod := range strings.Split(c.Query("users"), ",") {
+		if cod = strings.TrimSpace(cod); cod != "" && !slices.Contains(usuarios, cod) {
+			usuarios = append(usuarios, cod)
+		}
+	}
+	if len(usuarios) < 2 {
+		c.JSON(400, gin.H{"error": "users debe tener al menos un código de usuario"})
+		return
+	}
+	if len(usuarios) > maxUsuariosDisponibilidad {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Se pueden comparar como máximo %d usuarios", maxUsuariosDisponibilidad)})
+		return
+	}
+
+	desde, hasta, msg := leerRangoFechas(c, rangoLibres, rangoMaxLibres)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	busqueda, msg := leerBusquedaLibres(c)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	faltan, err := sinPermisoDisponibilidad(c, claims.UserID, usuarios)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if len(faltan) > 0 {
+		c.JSON(403, gin.H{
+			"error":   "Algunos usuarios no le han compartido su disponibilidad",
+			"missing": faltan,
+		})
+		return
+	}
+
+	// Las franjas libres comunes son las libres del horario con los bloques de todos
+	var bloques []BloqueHorario
+	for _, cod := range usuarios {
+		propios, err := bloquesUsuario(cod)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		bloques = append(bloques, propios...)
+	}
+
+	c.JSON(200, gin.H{
+		"users":    usuarios,
+		"from":     desde.Format(time.DateOnly),
+		"to":       hasta.Format(time.DateOnly),
+		"duration": int(busqueda.duracion.Minutes()),
+		"buffer":   int(busqueda.margen.Minutes()),
+		"slots":    franjasLibres(bloques, nil, desde, hasta, busqueda, time.Now().In(zonaInstitucion)),
+	})
+}
+
+// Junta los intervalos que se solapan o se tocan
+func unirIntervalos(intervalos []intervalo) []intervalo {
+	slices.SortFunc(intervalos, func(a, b intervalo) int {
+		return a.inicio.Compare(b.inicio)
+	})
+
+	var unidos []intervalo
+	for _, i := range intervalos {
+		if n := len(unidos); n > 0 && !i.inicio.After(unidos[n-1].fin) {
+			if i.fin.After(unidos[n-1].fin) {
+				unidos[n-1].fin = i.fin
+			}
+			continue
+		}
+		unidos = append(unidos, i)
+	}
+	return unidos
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ CALENDARIO POR FECHAS ------------------------ //
+
+const (
+	eventoRecordatorio = "recordatorio"
+
+	rangoCalendario    = 30 // días por defecto
+	rangoMaxCalendario = 366
+)
+
+// Ocurrencia concreta de una clase, actividad o recordatorio. Las horas van en
+// RFC 3339 con el desfase de zonaInstitucion (o la del usuario, con enZona).
+type EventoCalendario struct {
+	ID          string  `json:"id"`
+	Tipo        string  `json:"tipo"`
+	IdOrigen    int     `json:"idOrigen"`
+	Titulo      string  `json:"titulo"`
+	Descripcion string  `json:"descripcion,omitempty"`
+	Fecha       string  `json:"fecha"`
+	Dia         int     `json:"dia"`
+	Inicio      string  `json:"inicio"`
+	Fin         *string `json:"fin"`
+	TodoElDia   bool    `json:"todoElDia"`
+
+	// Solo clases oficiales
+	Nrc       string `json:"nrc,omitempty"`
+	Docente   string `json:"docente,omitempty"`
+	Salon     string `json:"salon,omitempty"`
+	Sede      string `json:"sede,omitempty"`
+	IdPeriodo int    `json:"idPeriodo,omitempty"`
+	Periodo   string `json:"periodo,omitempty"`
+
+	// Solo sesiones reprogramadas
+	Estado        string `json:"estado,omitempty"`
+	FechaOriginal string `json:"fechaOriginal,omitempty"`
+	Motivo        string `json:"motivo,omitempty"`
+
+	// Solo recordatorios
+	Prioridad  string `json:"prioridad,omitempty"`
+	Completado *bool  `json:"completado,omitempty"`
+
+	orden, termina time.Time
+}
+
+// Calendario del usuario autenticado con las ocurrencias entre from y to
+func getCalendar(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	desde, hasta, msg := leerRangoFechas(c, rangoCalendario, rangoMaxCalendario)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	inc, ok := leerIncluirCalendario(c.Query("include"))
+	if !ok {
+		c.JSON(400, gin.H{"error": "include debe ser una lista de official, personal y reminders"})
+		return
+	}
+
+	datos, err := consultarCalendario(claims.UserID, inc)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	zona := zonaUsuario(claims.UserID)
+	eventos := datos.expandir(desde, hasta)
+	for i := range eventos {
+		eventos[i].enZona(zona)
+	}
+
+	c.JSON(200, gin.H{
+		"from":                desde.Format(time.DateOnly),
+		"to":                  hasta.Format(time.DateOnly),
+		"timezone":            zona.String(),
+		"institutionTimezone": zonaInstitucion.String(),
+		"events":              eventos,
+	})
+}
+
+// Inicio y fin con el desfase de la zona del usuario. La fecha y el día siguen
+// siendo los de la institución, y los eventos de todo el día no se mueven.
+func (e *EventoCalendario) enZona(zona *time.Location) {
+	if e.TodoElDia {
+		return
+	}
+	e.Inicio = e.orden.In(zona).Format(time.RFC3339)
+	if e.Fin != nil {
+		fin := e.termina.In(zona).Format(time.RFC3339)
+		e.Fin = &fin
+	}
+}
+
+// Expande las filas semanales en ocurrencias con fecha entre desde y hasta (inclusivas),
+// ordenadas por hora de inicio. Las clases no aparecen en días sin clase ni en sesiones
+// canceladas, y las reprogramadas aparecen en su nueva fecha y hora.
+func (d datosCalendario) expandir(desde, hasta time.Time) []EventoCalendario {
+	eventos := []EventoCalendario{}
+
+	for _, clase := range d.clases {
+		b, err := bloqueClase(clase)
+		if err != nil {
+			log.Printf("Clase %d omitida del calendario: %v", clase.N_idHorario, err)
+			continue
+		}
+		for _, b := range d.excepciones.aplicar(b) {
+			for _, fecha := range b.fechas(desde, hasta) {
+				e := eventoBloque(b, fecha)
+				e.Nrc = clase.Nrc
+				e.Docente = clase.Teacher
+				e.Salon = clase.Classroom
+				e.Sede = clase.Campus
+				e.IdPeriodo = clase.N_idPeriodoAcademico
+				e.Periodo = clase.Periodo_academico
+				if x := b.Excepcion; x != nil {
+					e.ID = fmt.Sprintf("%s-r%d", e.ID, x.N_idExcepcion)
+					e.Estado = x.T_tipo
+					e.FechaOriginal = x.Dt_fecha
+					e.Motivo = x.T_motivo
+					if x.T_salon != nil {
+						e.Salon = *x.T_salon
+					}
+				}
+				eventos = append(eventos, e)
+			}
+		}
+	}
+
+	for _, actividad := range d.actividades {
+		if eliminadoNulo(actividad.IsDeleted) {
+			continue
+		}
+		var fi, ff *string
+		if actividad.Dt_Start.Valid {
+			fi = &actividad.Dt_Start.String
+		}
+		if actividad.Dt_End.Valid {
+			ff = &actividad.Dt_End.String
+		}
+		b, err := nuevoBloque(bloquePersonal, actividad.N_idcourse, actividad.Activity, actividad.Day, actividad.StartHour, actividad.EndHour, fi, ff)
+		if err != nil {
+			log.Printf("Actividad %d omitida del calendario: %v", actividad.N_idcourse, err)
+			continue
+		}
+		for _, fecha := range b.fechas(desde, hasta) {
+			e := eventoBloque(b, fecha)
+			e.Descripcion = actividad.Description.String
+			eventos = append(eventos, e)
+		}
+	}
+
+	for _, r := range d.recordatorios {
+		if e, ok := eventoDeRecordatorio(r, desde, hasta); ok {
+			eventos = append(eventos, e)
+		}
+	}
+
+	slices.SortStableFunc(eventos, func(a, b EventoCalendario) int {
+		if n := a.orden.Compare(b.orden); n != 0 {
+			return n
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return eventos
+}
+
+// Fechas entre desde y hasta en que ocurre el bloque
+func (b BloqueHorario) fechas(desde, hasta time.Time) []time.Time {
+	var fechas []time.Time
+	dia, _ := diaSemanaHorario(b.Dia)
+	fecha := desde.AddDate(0, 0, (int(dia)-int(desde.Weekday())+7)%7)
+	for ; !fecha.After(hasta); fecha = fecha.AddDate(0, 0, 7) {
+		if b.ocurreEn(fecha) {
+			fechas = append(fechas, fecha)
+		}
+	}
+	return fechas
+}
+
+func eventoBloque(b BloqueHorario, fecha time.Time) EventoCalendario {
+	inicio, fin := fecha.Add(b.inicio), fecha.Add(b.fin)
+	finTexto := fin.Format(time.RFC3339)
+	return EventoCalendario{
+		ID:       fmt.Sprintf("%s-%d-%s", b.Tipo, b.ID, fecha.Format("20060102")),
+		Tipo:     b.Tipo,
+		IdOrigen: b.ID,
+		Titulo:   b.Nombre,
+		Fecha:    fecha.Format(time.DateOnly),
+		Dia:      b.Dia,
+		Inicio:   inicio.Format(time.RFC3339),
+		Fin:      &finTexto,
+		orden:    inicio,
+		termina:  fin,
+	}
+}
+
+// Vencimiento de un recordatorio en zonaInstitucion; todoElDia si no tiene hora o
+// vence a medianoche. Lo usan el calendario, el .ics y las franjas libres.
+func vencimientoRecordatorio(r Reminders) (time.Time, bool, error) {
+	vence, soloFecha, err := leerFechaHoraBD(r.Dt_fechaVencimiento.String)
+	if err != nil {
+		return vence, false, err
+	}
+	medianoche := vence.Hour() == 0 && vence.Minute() == 0 && vence.Second() == 0
+	return vence, soloFecha || medianoche, nil
+}
+
+// Recordatorios no eliminados que vencen en el rango. Sin hora (o a medianoche)
+// se devuelven como evento de todo el día.
+func eventoDeRecordatorio(r Reminders, desde, hasta time.Time) (EventoCalendario, bool) {
+	if eliminado(r.B_isDeleted) || !r.Dt_fechaVencimiento.Valid {
+		return EventoCalendario{}, false
+	}
+
+	vence, todoElDia, err := vencimientoRecordatorio(r)
+	if err != nil {
+		log.Printf("Recordatorio %d con fecha inválida, se omite del calendario", r.N_idRecordatorio)
+		return EventoCalendario{}, false
+	}
+	fecha := time.Date(vence.Year(), vence.Month(), vence.Day(), 0, 0, 0, 0, zonaInstitucion)
+	if fecha.Before(desde) || fecha.After(hasta) {
+		return EventoCalendario{}, false
+	}
+
+	completado := r.B_estado != nil && *r.B_estado
+	return EventoCalendario{
+		ID:          fmt.Sprintf("%s-%d", eventoRecordatorio, r.N_idRecordatorio),
+		Tipo:        eventoRecordatorio,
+		IdOrigen:    r.N_idRecordatorio,
+		Titulo:      r.T_nombre,
+		Descripcion: r.T_descripcion.String,
+		Fecha:       fecha.Format(time.DateOnly),
+		Dia:         diaHorario(fecha.Weekday()),
+		Inicio:      vence.Format(time.RFC3339),
+		TodoElDia:   todoElDia,
+		Prioridad:   r.T_Prioridad,
+		Completado:  &completado,
+		orden:       vence,
+		termina:     vence,
+	}, true
+}
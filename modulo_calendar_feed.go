@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ SUSCRIPCIÓN AL CALENDARIO ------------------------ //
+
+// En Redis solo se guarda el hash del token:
+//   feed:<sha256>          -> código del usuario
+//   feedtoken:<codUsuario> -> {hash, creado}
+// El .ics generado se guarda en CalendarFeed:<codUsuario> y su ETag y fecha
+// de modificación en CalendarFeedMeta:<codUsuario>.
+
+func hashTokenFeed(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
+
+// Estado del token de suscripción del usuario (nunca se devuelve el token)
+func getFeedToken(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	datos, err := rdb.HGetAll(c.Request.Context(), "feedtoken:"+claims.UserID).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if len(datos) == 0 {
+		c.JSON(200, gin.H{"active": false})
+		return
+	}
+	c.JSON(200, gin.H{
+		"active":    true,
+		"createdAt": datos["creado"],
+	})
+}
+
+// Crea el token de suscripción; si ya hay uno se debe rotar o revocar
+func createFeedToken(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	existe, err := rdb.Exists(c.Request.Context(), "feedtoken:"+claims.UserID).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if existe > 0 {
+		c.JSON(409, gin.H{"error": "Ya existe un enlace de suscripción, use rotate o revoke"})
+		return
+	}
+
+	emitirTokenFeed(c, claims.UserID, accionCrearTokenCalendario)
+}
+
+// Reemplaza el token: la URL anterior deja de funcionar
+func rotateFeedToken(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	if !revocarTokenFeed(c, claims.UserID) {
+		return
+	}
+	emitirTokenFeed(c, claims.UserID, accionRotarTokenCalendario)
+}
+
+func revokeFeedToken(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	if !revocarTokenFeed(c, claims.UserID) {
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionRevocarTokenCalendario, objetivoTokenCalendario, claims.UserID,
+		"Se revocó el enlace de suscripción al calendario | Usuario: "+claims.UserID)
+
+	c.JSON(200, gin.H{"message": "Enlace de suscripción revocado"})
+}
+
+func emitirTokenFeed(c *gin.Context, codUsuario string, accion AccionAuditoria) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generando token: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	hash := hashTokenFeed(token)
+	creado := time.Now().UTC().Format(time.RFC3339)
+
+	pipe := rdb.TxPipeline()
+	pipe.Set(c.Request.Context(), "feed:"+hash, codUsuario, 0)
+	pipe.HSet(c.Request.Context(), "feedtoken:"+codUsuario, "hash", hash, "creado", creado)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(codUsuario), accion, objetivoTokenCalendario, codUsuario,
+		"Se emitió enlace de suscripción al calendario | Usuario: "+codUsuario)
+
+	ruta := "/api/v1/calendar/feed/" + token + ".ics"
+	respuesta := gin.H{
+		"token":     token,
+		"path":      ruta,
+		"createdAt": creado,
+	}
+	// Prefijo público de la API, p. ej. https://api.tudominio.com
+	if base := os.Getenv("CALENDAR_FEED_BASE_URL"); base != "" {
+		respuesta["url"] = strings.TrimSuffix(base, "/") + ruta
+	}
+
+	c.JSON(200, respuesta)
+}
+
+// Borra el token actual; responde con error y devuelve false si Redis falla
+func revocarTokenFeed(c *gin.Context, codUsuario string) bool {
+	hash, err := rdb.HGet(c.Request.Context(), "feedtoken:"+codUsuario, "hash").Result()
+	if errors.Is(err, redis.Nil) {
+		c.JSON(404, gin.H{"error": "No hay enlace de suscripción"})
+		return false
+	}
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return false
+	}
+
+	if err := rdb.Del(c.Request.Context(), "feed:"+hash, "feedtoken:"+codUsuario).Err(); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return false
+	}
+	return true
+}
+
+// Feed público para las aplicaciones de calendario: sin JWT ni API key, el token es la credencial
+func getCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	codUsuario, err := rdb.Get(c.Request.Context(), "feed:"+hashTokenFeed(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		c.JSON(404, gin.H{"error": "Calendario no encontrado"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	cuerpo, etag, modificado, err := feedCalendario(c, codUsuario)
+	if err != nil {
+		log.Printf("Error generando feed de calendario: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modificado.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, max-age=300")
+
+	if noModificado(c, etag, modificado) {
+		c.Status(304)
+		return
+	}
+	c.Data(200, "text/calendar; charset=utf-8", cuerpo)
+}
+
+// Devuelve el .ics del usuario desde Redis o lo genera. Last-Modified solo
+// avanza cuando cambia el contenido, aunque la caché se haya invalidado.
+func feedCalendario(c *gin.Context, codUsuario string) ([]byte, string, time.Time, error) {
+	meta, err := rdb.HGetAll(c.Request.Context(), "CalendarFeedMeta:"+codUsuario).Result()
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	segundos, _ := strconv.ParseInt(meta["modificado"], 10, 64)
+	modificado := time.Unix(segundos, 0)
+
+	if cuerpo, err := rdb.Get(c.Request.Context(), "CalendarFeed:"+codUsuario).Bytes(); err == nil && meta["etag"] != "" {
+		return cuerpo, meta["etag"], modificado, nil
+	}
+
+	datos, err := consultarCalendario(codUsuario, incluirCalendario{true, true, true})
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	cuerpo := datos.ics(modificado)
+	etag := etagCalendario(cuerpo)
+	if etag != meta["etag"] {
+		// Cambió el contenido: nueva fecha de modificación (y de DTSTAMP)
+		modificado = time.Now().Truncate(time.Second)
+		cuerpo = datos.ics(modificado)
+		etag = etagCalendario(cuerpo)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(c.Request.Context(), "CalendarFeedMeta:"+codUsuario, "etag", etag, "modificado", modificado.Unix())
+	pipe.Set(c.Request.Context(), "CalendarFeed:"+codUsuario, cuerpo, envDuration("CALENDAR_FEED_TTL", time.Hour))
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis guardando feed de calendario: %v", err)
+	}
+
+	return cuerpo, etag, modificado, nil
+}
+
+func etagCalendario(cuerpo []byte) string {
+	suma := sha256.Sum256(cuerpo)
+	return fmt.Sprintf(`"%x"`, suma[:16])
+}
+
+// If-None-Match tiene prioridad sobre If-Modified-Since
+func noModificado(c *gin.Context, etag string, modificado time.Time) bool {
+	if valor := c.GetHeader("If-None-Match"); valor != "" {
+		for _, candidato := range strings.Split(valor, ",") {
+			candidato = strings.TrimPrefix(strings.TrimSpace(candidato), "W/")
+			if candidato == etag || candidato == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if valor := c.GetHeader("If-Modified-Since"); valor != "" {
+		if t, err := http.ParseTime(valor); err == nil {
+			return !modificado.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// Se llama después de cambiar el horario, las actividades o los recordatorios del usuario
+func invalidarCalendario(codUsuario string) {
+	if err := rdb.Del(ctx, "CalendarFeed:"+codUsuario).Err(); err != nil {
+		fmt.Printf("\nError de conexión: %v", err)
+	}
+}
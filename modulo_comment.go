@@ -192,14 +192,11 @@ func addPersonalComment(c *gin.Context) {
 		strconv.FormatInt(insertedID, 10) +
 		" | Horario: " + strconv.Itoa(newComment.N_idHorario)
 
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Println("panic en insertarLog:", r)
-			}
-		}()
-		insertarLog(newComment.N_idUsuario, "CREAR_COMENTARIO", descripcion)
-	}()
+	evento := nuevoEvento(c, accionCrearComentario, objetivoComentario, strconv.FormatInt(insertedID, 10))
+	evento.UsuarioID = newComment.N_idUsuario
+	evento.Despues = instantaneaComentario(int(insertedID))
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(200, gin.H{
@@ -249,6 +246,8 @@ func updatePersonalComment(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaComentario(newComment.N_idComentarios)
+
 	result, err := db.Exec(
 		"CALL editar_comentario(? , ?)",
 		newComment.N_idComentarios,
@@ -266,14 +265,12 @@ func updatePersonalComment(c *gin.Context) {
 		newComment.N_idComentarios,
 		newComment.N_idUsuario)
 
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Editar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(newComment.N_idUsuario, "ACTUALIZAR_COMENTARIO", descripcion)
+	evento := nuevoEvento(c, accionActualizarComentario, objetivoComentario, strconv.Itoa(newComment.N_idComentarios))
+	evento.UsuarioID = newComment.N_idUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaComentario(newComment.N_idComentarios)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(200, gin.H{
@@ -321,6 +318,8 @@ func deletePersonalComment(c *gin.Context) {
 		fmt.Printf("\nNo es encontró registro relacionado")
 	}
 
+	antes := instantaneaComentario(delComment.N_idComentarios)
+
 	result, err := db.Exec(
 		"CALL eliminar_comentario(?)",
 		delComment.N_idComentarios,
@@ -337,14 +336,13 @@ func deletePersonalComment(c *gin.Context) {
 		delComment.N_idComentarios,
 		delComment.N_idUsuario)
 
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(delComment.N_idUsuario, "ELIMINAR_COMENTARIO", descripcion)
+	evento := nuevoEvento(c, accionEliminarComentario, objetivoComentario, strconv.Itoa(delComment.N_idComentarios))
+	evento.UsuarioID = delComment.N_idUsuario
+	evento.CodUsuario = *delComment.CodUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaComentario(delComment.N_idComentarios)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(200, gin.H{
@@ -352,3 +350,23 @@ func deletePersonalComment(c *gin.Context) {
 		"rowsAffected": rowsAffected,
 	})
 }
+
+// Estado de un comentario para las instantáneas de auditoría; nil si no se pudo leer
+func instantaneaComentario(idComentario int) *ofcComments {
+	var ofcComment ofcComments
+
+	err := db.QueryRow(`SELECT * FROM ComentariosOficiales WHERE N_idComentarios = ?`, idComentario).Scan(
+		&ofcComment.N_idHorario,
+		&ofcComment.N_idUsuario,
+		&ofcComment.N_idCurso,
+		&ofcComment.Curso,
+		&ofcComment.N_idComentarios,
+		&ofcComment.T_comentario,
+		&ofcComment.B_isDeleted,
+	)
+	if err != nil {
+		log.Printf("Error leyendo comentario para auditoría: %v", err)
+		return nil
+	}
+	return &ofcComment
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ CONFLICTOS DE HORARIO ------------------------ //
+
+const (
+	bloqueOficial  = "oficial"
+	bloquePersonal = "personal"
+
+	rangoConflictos    = 120 // días por defecto
+	rangoMaxConflictos = 366
+)
+
+// Clase o actividad que se repite cada semana en un día y franja, dentro de un rango de fechas
+type BloqueHorario struct {
+	Tipo        string  `json:"tipo"`
+	ID          int     `json:"id"`
+	Nombre      string  `json:"nombre"`
+	Dia         int     `json:"dia"`
+	HoraInicio  string  `json:"horaInicio"`
+	HoraFin     string  `json:"horaFin"`
+	FechaInicio *string `json:"fechaInicio"`
+	FechaFin    *string `json:"fechaFin"`
+
+	// Solo en la sesión reprogramada de una clase oficial
+	Excepcion *ExcepcionClase `json:"excepcion,omitempty"`
+
+	inicio, fin  time.Duration
+	desde, hasta *time.Time
+
+	// Clases oficiales: NRC y periodo para aplicar las excepciones, y las
+	// fechas (YYYY-MM-DD) en que no hay clase
+	nrc       string
+	idPeriodo int
+	omitir    map[string]bool
+}
+
+// Dos bloques que se cruzan: la franja común y las fechas en que ocurre
+type ConflictoHorario struct {
+	A           BloqueHorario `json:"a"`
+	B           BloqueHorario `json:"b"`
+	Dia         int           `json:"dia"`
+	HoraInicio  string        `json:"horaInicio"`
+	HoraFin     string        `json:"horaFin"`
+	Primera     string        `json:"primera"`
+	Ultima      string        `json:"ultima"`
+	Ocurrencias int           `json:"ocurrencias"`
+}
+
+func nuevoBloque(tipo string, id int, nombre string, dia int, horaInicio, horaFin string, fechaInicio, fechaFin *string) (BloqueHorario, error) {
+	b := BloqueHorario{
+		Tipo:        tipo,
+		ID:          id,
+		Nombre:      nombre,
+		Dia:         dia,
+		HoraInicio:  horaInicio,
+		HoraFin:     horaFin,
+		FechaInicio: fechaInicio,
+		FechaFin:    fechaFin,
+	}
+
+	var err error
+	if _, ok := diaSemanaHorario(dia); !ok {
+		return b, fmt.Errorf("día inválido %d", dia)
+	}
+	if b.inicio, err = leerHoraBD(horaInicio); err != nil {
+		return b, err
+	}
+	if b.fin, err = leerHoraBD(horaFin); err != nil {
+		return b, err
+	}
+	if b.fin <= b.inicio {
+		return b, fmt.Errorf("la hora final debe ser posterior a la inicial")
+	}
+	if fechaInicio != nil && *fechaInicio != "" {
+		t, err := leerFechaBD(*fechaInicio)
+		if err != nil {
+			return b, err
+		}
+		b.desde = &t
+	}
+	if fechaFin != nil && *fechaFin != "" {
+		t, err := leerFechaBD(*fechaFin)
+		if err != nil {
+			return b, err
+		}
+		b.hasta = &t
+	}
+	return b, nil
+}
+
+// Bloque de una clase oficial, limitado por las fechas de su periodo académico
+func bloqueClase(clase OfficialSchedule) (BloqueHorario, error) {
+	desde, hasta := clase.FechaInicio, clase.FechaFinal
+	b, err := nuevoBloque(bloqueOficial, clase.N_idHorario, clase.Course, clase.Day, clase.StartHour, clase.EndHour, &desde, &hasta)
+	b.nrc, b.idPeriodo = clase.Nrc, clase.N_idPeriodoAcademico
+	return b, err
+}
+
+// Si el bloque tiene una ocurrencia en la fecha (medianoche en zonaInstitucion)
+func (b BloqueHorario) ocurreEn(fecha time.Time) bool {
+	if diaHorario(fecha.Weekday()) != b.Dia {
+		return false
+	}
+	if b.omitir[fecha.Format(time.DateOnly)] {
+		return false
+	}
+	if b.desde != nil && fecha.Before(*b.desde) {
+		return false
+	}
+	return b.hasta == nil || !fecha.After(*b.hasta)
+}
+
+// Clases oficiales, con sus días sin clase y excepciones aplicados, y actividades
+// personales activas del usuario. Las filas con datos inválidos se omiten y se registran.
+func bloquesUsuario(codUsuario string) ([]BloqueHorario, error) {
+	clases, err := consultarHorarioOficial(codUsuario)
+	if err != nil {
+		return nil, err
+	}
+	excepciones, err := cargarExcepciones()
+	if err != nil {
+		return nil, err
+	}
+	actividades, err := consultarActividadesPersonales(codUsuario)
+	if err != nil {
+		return nil, err
+	}
+
+	var bloques []BloqueHorario
+	for _, clase := range clases {
+		b, err := bloqueClase(clase)
+		if err != nil {
+			log.Printf("Clase %d omitida en conflictos: %v", clase.N_idHorario, err)
+			continue
+		}
+		bloques = append(bloques, excepciones.aplicar(b)...)
+	}
+
+	for _, actividad := range actividades {
+		if actividad.IsDeleted != nil && actividad.IsDeleted.Valid && actividad.IsDeleted.Bool {
+			continue
+		}
+		var desde, hasta *string
+		if actividad.Dt_Start.Valid {
+			desde = &actividad.Dt_Start.String
+		}
+		if actividad.Dt_End.Valid {
+			hasta = &actividad.Dt_End.String
+		}
+		b, err := nuevoBloque(bloquePersonal, actividad.N_idcourse, actividad.Activity, actividad.Day, actividad.StartHour, actividad.EndHour, desde, hasta)
+		if err != nil {
+			log.Printf("Actividad %d omitida en conflictos: %v", actividad.N_idcourse, err)
+			continue
+		}
+		bloques = append(bloques, b)
+	}
+	return bloques, nil
+}
+
+// Todos los pares de bloques que se cruzan entre desde y hasta (fechas inclusivas)
+func detectarConflictos(bloques []BloqueHorario, desde, hasta time.Time) []ConflictoHorario {
+	conflictos := []ConflictoHorario{}
+	for i := range bloques {
+		for j := i + 1; j < len(bloques); j++ {
+			if c, ok := cruce(bloques[i], bloques[j], desde, hasta); ok {
+				conflictos = append(conflictos, c)
+			}
+		}
+	}
+	return conflictos
+}
+
+// Conflictos de un bloque nuevo o editado con los demás; se ignora el mismo bloque
+func conflictosDe(nuevo BloqueHorario, bloques []BloqueHorario, desde, hasta time.Time) []ConflictoHorario {
+	conflictos := []ConflictoHorario{}
+	for _, b := range bloques {
+		if b.Tipo == nuevo.Tipo && b.ID == nuevo.ID && nuevo.ID != 0 {
+			continue
+		}
+		if c, ok := cruce(nuevo, b, desde, hasta); ok {
+			conflictos = append(conflictos, c)
+		}
+	}
+	return conflictos
+}
+
+// Revisa si una actividad personal que se va a crear o editar choca con el resto
+// del horario. Si hay cruces y no se permiten responde 409; devuelve false cuando
+// ya se respondió y no se debe guardar.
+func verificarConflictos(c *gin.Context, codUsuario string, nuevo BloqueHorario, permitir bool) ([]ConflictoHorario, bool) {
+	bloques, err := bloquesUsuario(codUsuario)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+
+	// Desde el inicio de la actividad (u hoy) hasta su fin, cruce() recorta con FechaFin
+	hoy := time.Now().In(zonaInstitucion)
+	desde := time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, zonaInstitucion)
+	if nuevo.desde != nil {
+		desde = *nuevo.desde
+	}
+	hasta := desde.AddDate(0, 0, rangoMaxConflictos)
+
+	conflictos := conflictosDe(nuevo, bloques, desde, hasta)
+	if len(conflictos) > 0 && !permitir {
+		c.JSON(409, gin.H{
+			"error":     "La actividad se cruza con otras clases o actividades",
+			"conflicts": conflictos,
+		})
+		return conflictos, false
+	}
+	return conflictos, true
+}
+
+func cruce(a, b BloqueHorario, desde, hasta time.Time) (ConflictoHorario, bool) {
+	if a.Dia != b.Dia || a.inicio >= b.fin || b.inicio >= a.fin {
+		return ConflictoHorario{}, false
+	}
+
+	// Fechas en que ambos están vigentes, recortadas al rango pedido
+	for _, limite := range []*time.Time{a.desde, b.desde} {
+		if limite != nil && limite.After(desde) {
+			desde = *limite
+		}
+	}
+	for _, limite := range []*time.Time{a.hasta, b.hasta} {
+		if limite != nil && limite.Before(hasta) {
+			hasta = *limite
+		}
+	}
+
+	dia, _ := diaSemanaHorario(a.Dia)
+	primera := desde.AddDate(0, 0, (int(dia)-int(desde.Weekday())+7)%7)
+	if primera.After(hasta) {
+		return ConflictoHorario{}, false
+	}
+	ultima := hasta.AddDate(0, 0, -((int(hasta.Weekday()) - int(dia) + 7) % 7))
+	ocurrencias := diasEntre(primera, ultima)/7 + 1
+
+	// Con días sin clase o sesiones canceladas se cuentan solo las semanas en que ambos ocurren
+	if len(a.omitir) > 0 || len(b.omitir) > 0 {
+		var fechas []time.Time
+		for fecha := primera; !fecha.After(ultima); fecha = fecha.AddDate(0, 0, 7) {
+			if a.ocurreEn(fecha) && b.ocurreEn(fecha) {
+				fechas = append(fechas, fecha)
+			}
+		}
+		if len(fechas) == 0 {
+			return ConflictoHorario{}, false
+		}
+		primera, ultima, ocurrencias = fechas[0], fechas[len(fechas)-1], len(fechas)
+	}
+
+	return ConflictoHorario{
+		A:           a,
+		B:           b,
+		Dia:         a.Dia,
+		HoraInicio:  formatoHora(max(a.inicio, b.inicio)),
+		HoraFin:     formatoHora(min(a.fin, b.fin)),
+		Primera:     primera.Format(time.DateOnly),
+		Ultima:      ultima.Format(time.DateOnly),
+		Ocurrencias: ocurrencias,
+	}, true
+}
+
+// Días de calendario entre dos fechas, sin depender de cambios de horario
+func diasEntre(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+func formatoHora(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// from/to en YYYY-MM-DD; por defecto desde hoy y porDefecto días, como máximo maximo días
+func leerRangoFechas(c *gin.Context, porDefecto, maximo int) (time.Time, time.Time, string) {
+	hoy := time.Now().In(zonaInstitucion)
+	desde := time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, zonaInstitucion)
+
+	if valor := c.Query("from"); valor != "" {
+		t, err := time.ParseInLocation(time.DateOnly, valor, zonaInstitucion)
+		if err != nil {
+			return desde, desde, "from debe ser YYYY-MM-DD"
+		}
+		desde = t
+	}
+
+	hasta := desde.AddDate(0, 0, porDefecto)
+	if valor := c.Query("to"); valor != "" {
+		t, err := time.ParseInLocation(time.DateOnly, valor, zonaInstitucion)
+		if err != nil {
+			return desde, hasta, "to debe ser YYYY-MM-DD"
+		}
+		hasta = t
+	}
+
+	if hasta.Before(desde) {
+		return desde, hasta, "to debe ser posterior a from"
+	}
+	if diasEntre(desde, hasta) > maximo {
+		return desde, hasta, fmt.Sprintf("El rango no puede superar %d días", maximo)
+	}
+	return desde, hasta, ""
+}
+
+// Cruces entre clases oficiales y actividades personales del usuario en un rango de fechas
+func getScheduleConflicts(c *gin.Context) {
+	codUsuario := c.Param("id")
+
+	desde, hasta, msg := leerRangoFechas(c, rangoConflictos, rangoMaxConflictos)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	bloques, err := bloquesUsuario(codUsuario)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"from":      desde.Format(time.DateOnly),
+		"to":        hasta.Format(time.DateOnly),
+		"conflicts": detectarConflictos(bloques, desde, hasta),
+	})
+}
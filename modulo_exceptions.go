@@ -0,0 +1,672 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ DÍAS SIN CLASE Y EXCEPCIONES ------------------------ //
+
+const (
+	sinClaseFestivo = "festivo"
+	sinClaseReceso  = "receso"
+
+	excepcionCancelada    = "cancelada"
+	excepcionReprogramada = "reprogramada"
+
+	// Días sin clase y excepciones activas de todos los periodos, en una sola clave
+	// porque cada expansión de horario necesita ambas
+	claveExcepciones    = "ExcepcionesHorario"
+	vigenciaExcepciones = 10 * time.Minute
+)
+
+type excepcionesHorario struct {
+	SinClase []DiaSinClase    `json:"sinClase"`
+	Clases   []ExcepcionClase `json:"clases"`
+}
+
+// Clase oficial con el código de su usuario, para avisar a los inscritos
+type claseInscrita struct {
+	codUsuario string
+	OfficialSchedule
+}
+
+// Días sin clase activos de un periodo académico
+func getNonClassDays(c *gin.Context) {
+	idPeriodo, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id de periodo inválido"})
+		return
+	}
+
+	excepciones, err := cargarExcepciones()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	dias := []DiaSinClase{}
+	for _, d := range excepciones.SinClase {
+		if d.N_idPeriodoAcademico == idPeriodo {
+			dias = append(dias, d)
+		}
+	}
+	c.JSON(200, dias)
+}
+
+// Registra un festivo o receso; sin fechaFinal es un solo día
+func addNonClassDay(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req NewDiaSinClase
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	req.T_motivo = strings.TrimSpace(req.T_motivo)
+	if req.T_tipo != sinClaseFestivo && req.T_tipo != sinClaseReceso {
+		c.JSON(400, gin.H{"error": "tipo debe ser festivo o receso"})
+		return
+	}
+	if req.T_motivo == "" {
+		c.JSON(400, gin.H{"error": "motivo es obligatorio"})
+		return
+	}
+	if req.Dt_fechaFinal == "" {
+		req.Dt_fechaFinal = req.Dt_fechaInicio
+	}
+	inicio, err1 := time.ParseInLocation(time.DateOnly, req.Dt_fechaInicio, zonaInstitucion)
+	fin, err2 := time.ParseInLocation(time.DateOnly, req.Dt_fechaFinal, zonaInstitucion)
+	if err1 != nil || err2 != nil {
+		c.JSON(400, gin.H{"error": "fechaInicio y fechaFinal deben ser YYYY-MM-DD"})
+		return
+	}
+	if fin.Before(inicio) {
+		c.JSON(400, gin.H{"error": "fechaFinal debe ser posterior a fechaInicio"})
+		return
+	}
+
+	periodo, ok := periodoParaExcepcion(c, req.N_idPeriodoAcademico)
+	if !ok {
+		return
+	}
+	if !dentroDePeriodo(periodo, inicio) || !dentroDePeriodo(periodo, fin) {
+		c.JSON(400, gin.H{"error": "Las fechas deben estar dentro del periodo académico"})
+		return
+	}
+
+	result, err := db.Exec(`INSERT INTO DiasSinClase (N_idPeriodoAcademico, Dt_fechaInicio, Dt_fechaFinal, T_tipo, T_motivo) VALUES (?, ?, ?, ?, ?)`,
+		req.N_idPeriodoAcademico, req.Dt_fechaInicio, req.Dt_fechaFinal, req.T_tipo, req.T_motivo)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	id, _ := result.LastInsertId()
+	invalidarExcepciones()
+
+	dia := DiaSinClase{
+		N_idDiaSinClase:      int(id),
+		N_idPeriodoAcademico: req.N_idPeriodoAcademico,
+		Dt_fechaInicio:       req.Dt_fechaInicio,
+		Dt_fechaFinal:        req.Dt_fechaFinal,
+		T_tipo:               req.T_tipo,
+		T_motivo:             req.T_motivo,
+	}
+
+	evento := nuevoEvento(c, accionCrearDiaSinClase, objetivoDiaSinClase, strconv.Itoa(dia.N_idDiaSinClase))
+	evento.UsuarioID = idUsuarioPorCodigo(claims.UserID)
+	evento.Despues = dia
+	evento.Descripcion = "Se agregó un día sin clase: " +
+		" | Periodo: " + periodo.T_nombre +
+		" | Fechas: " + dia.Dt_fechaInicio + " a " + dia.Dt_fechaFinal +
+		" | Tipo: " + dia.T_tipo +
+		" | Motivo: " + dia.T_motivo
+	registrarEvento(evento)
+
+	go avisarInscritos(dia.N_idPeriodoAcademico, "",
+		"No hay clases: "+dia.T_motivo,
+		"No habrá clases "+rangoTexto(dia.Dt_fechaInicio, dia.Dt_fechaFinal)+" ("+periodo.T_nombre+"). Motivo: "+dia.T_motivo+".")
+
+	c.JSON(200, gin.H{
+		"message":     "Día sin clase registrado correctamente",
+		"nonClassDay": dia,
+	})
+}
+
+func deleteNonClassDay(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req EliminarExcepcionRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+
+	var dia DiaSinClase
+	err := db.QueryRow(`SELECT N_idDiaSinClase, N_idPeriodoAcademico, Dt_fechaInicio, Dt_fechaFinal, T_tipo, T_motivo FROM DiasSinClase WHERE N_idDiaSinClase = ? AND B_isDeleted = 0`, req.ID).Scan(
+		&dia.N_idDiaSinClase,
+		&dia.N_idPeriodoAcademico,
+		&dia.Dt_fechaInicio,
+		&dia.Dt_fechaFinal,
+		&dia.T_tipo,
+		&dia.T_motivo,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Día sin clase no encontrado"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE DiasSinClase SET B_isDeleted = 1 WHERE N_idDiaSinClase = ?`, req.ID); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	invalidarExcepciones()
+
+	evento := nuevoEvento(c, accionEliminarDiaSinClase, objetivoDiaSinClase, strconv.Itoa(dia.N_idDiaSinClase))
+	evento.UsuarioID = idUsuarioPorCodigo(claims.UserID)
+	evento.Antes = dia
+	evento.Descripcion = "Se eliminó un día sin clase: " +
+		" | ID: " + strconv.Itoa(dia.N_idDiaSinClase) +
+		" | Fechas: " + dia.Dt_fechaInicio + " a " + dia.Dt_fechaFinal
+	registrarEvento(evento)
+
+	go avisarInscritos(dia.N_idPeriodoAcademico, "",
+		"Se reanudan las clases",
+		"Se canceló el día sin clase "+rangoTexto(dia.Dt_fechaInicio, dia.Dt_fechaFinal)+" ("+dia.T_motivo+"). Las clases de esas fechas se dictan según el horario.")
+
+	c.JSON(200, gin.H{
+		"message": "Día sin clase eliminado correctamente",
+	})
+}
+
+// Excepciones activas, filtradas por periodo y NRC si se indican
+func getClassExceptions(c *gin.Context) {
+	idPeriodo := 0
+	if valor := c.Query("period"); valor != "" {
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 1 {
+			c.JSON(400, gin.H{"error": "period debe ser el id de un periodo académico"})
+			return
+		}
+		idPeriodo = n
+	}
+	nrc := strings.TrimSpace(c.Query("nrc"))
+
+	excepciones, err := cargarExcepciones()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	lista := []ExcepcionClase{}
+	for _, x := range excepciones.Clases {
+		if (idPeriodo == 0 || x.N_idPeriodoAcademico == idPeriodo) && (nrc == "" || x.T_nrc == nrc) {
+			lista = append(lista, x)
+		}
+	}
+	c.JSON(200, lista)
+}
+
+// Cancela o reprograma la sesión de un NRC en una fecha. Una reprogramación
+// cambia la fecha, las horas o ambas; el salón es opcional.
+func addClassException(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req NewExcepcionClase
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	req.T_nrc = strings.TrimSpace(req.T_nrc)
+	req.T_motivo = strings.TrimSpace(req.T_motivo)
+	if req.T_nrc == "" || req.T_motivo == "" {
+		c.JSON(400, gin.H{"error": "nrc y motivo son obligatorios"})
+		return
+	}
+	fecha, err := time.ParseInLocation(time.DateOnly, req.Dt_fecha, zonaInstitucion)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "fecha debe ser YYYY-MM-DD"})
+		return
+	}
+
+	switch req.T_tipo {
+	case excepcionCancelada:
+		req.Dt_nuevaFecha, req.T_horaInicio, req.T_horaFin, req.T_salon = nil, nil, nil, nil
+	case excepcionReprogramada:
+		if (req.T_horaInicio == nil) != (req.T_horaFin == nil) {
+			c.JSON(400, gin.H{"error": "horaInicio y horaFin van juntas"})
+			return
+		}
+		if req.Dt_nuevaFecha == nil && req.T_horaInicio == nil {
+			c.JSON(400, gin.H{"error": "Una reprogramación necesita nuevaFecha u horaInicio y horaFin"})
+			return
+		}
+		if req.T_horaInicio != nil {
+			inicio, err1 := leerHoraBD(*req.T_horaInicio)
+			fin, err2 := leerHoraBD(*req.T_horaFin)
+			if err1 != nil || err2 != nil {
+				c.JSON(400, gin.H{"error": "horaInicio y horaFin deben ser HH:MM"})
+				return
+			}
+			if fin <= inicio {
+				c.JSON(400, gin.H{"error": "horaFin debe ser posterior a horaInicio"})
+				return
+			}
+		}
+		if req.T_salon != nil && strings.TrimSpace(*req.T_salon) == "" {
+			req.T_salon = nil
+		}
+	default:
+		c.JSON(400, gin.H{"error": "tipo debe ser cancelada o reprogramada"})
+		return
+	}
+
+	periodo, ok := periodoParaExcepcion(c, req.N_idPeriodoAcademico)
+	if !ok {
+		return
+	}
+	if req.Dt_nuevaFecha != nil {
+		nueva, err := time.ParseInLocation(time.DateOnly, *req.Dt_nuevaFecha, zonaInstitucion)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "nuevaFecha debe ser YYYY-MM-DD"})
+			return
+		}
+		if !dentroDePeriodo(periodo, nueva) {
+			c.JSON(400, gin.H{"error": "nuevaFecha debe estar dentro del periodo académico"})
+			return
+		}
+	}
+
+	// El NRC debe tener sesión ese día de la semana dentro del periodo
+	clases, err := clasesOficialesDePeriodo(req.N_idPeriodoAcademico, req.T_nrc)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	var curso string
+	for _, clase := range clases {
+		if b, err := bloqueClase(clase.OfficialSchedule); err == nil && b.ocurreEn(fecha) {
+			curso = clase.Course
+			break
+		}
+	}
+	if curso == "" {
+		c.JSON(400, gin.H{"error": "El NRC no tiene clase en esa fecha dentro del periodo"})
+		return
+	}
+
+	var existentes int
+	err = db.QueryRow(`SELECT COUNT(*) FROM ExcepcionesClase WHERE N_idPeriodoAcademico = ? AND T_nrc = ? AND Dt_fecha = ? AND B_isDeleted = 0`,
+		req.N_idPeriodoAcademico, req.T_nrc, req.Dt_fecha).Scan(&existentes)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if existentes > 0 {
+		c.JSON(409, gin.H{"error": "Ya existe una excepción para esa sesión; elimínela antes de registrar otra"})
+		return
+	}
+
+	result, err := db.Exec(`INSERT INTO ExcepcionesClase (N_idPeriodoAcademico, T_nrc, Dt_fecha, T_tipo, Dt_nuevaFecha, T_horaInicio, T_horaFin, T_salon, T_motivo) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.N_idPeriodoAcademico, req.T_nrc, req.Dt_fecha, req.T_tipo, req.Dt_nuevaFecha, req.T_horaInicio, req.T_horaFin, req.T_salon, req.T_motivo)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	id, _ := result.LastInsertId()
+	invalidarExcepciones()
+
+	x := ExcepcionClase{
+		N_idExcepcion:        int(id),
+		N_idPeriodoAcademico: req.N_idPeriodoAcademico,
+		T_nrc:                req.T_nrc,
+		Dt_fecha:             req.Dt_fecha,
+		T_tipo:               req.T_tipo,
+		Dt_nuevaFecha:        req.Dt_nuevaFecha,
+		T_horaInicio:         req.T_horaInicio,
+		T_horaFin:            req.T_horaFin,
+		T_salon:              req.T_salon,
+		T_motivo:             req.T_motivo,
+	}
+
+	evento := nuevoEvento(c, accionCrearExcepcionClase, objetivoExcepcionClase, strconv.Itoa(x.N_idExcepcion))
+	evento.UsuarioID = idUsuarioPorCodigo(claims.UserID)
+	evento.Despues = x
+	evento.Descripcion = "Se registró una excepción de clase: " +
+		" | NRC: " + x.T_nrc +
+		" | Fecha: " + x.Dt_fecha +
+		" | Tipo: " + x.T_tipo +
+		" | Motivo: " + x.T_motivo
+	registrarEvento(evento)
+
+	asunto, contenido := avisoExcepcion(x, curso)
+	go avisarInscritos(x.N_idPeriodoAcademico, x.T_nrc, asunto, contenido)
+
+	c.JSON(200, gin.H{
+		"message":   "Excepción registrada correctamente",
+		"exception": x,
+	})
+}
+
+func deleteClassException(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req EliminarExcepcionRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+
+	excepciones, err := cargarExcepciones()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	i := slices.IndexFunc(excepciones.Clases, func(x ExcepcionClase) bool { return x.N_idExcepcion == req.ID })
+	if i < 0 {
+		c.JSON(404, gin.H{"error": "Excepción no encontrada"})
+		return
+	}
+	x := excepciones.Clases[i]
+
+	if _, err := db.Exec(`UPDATE ExcepcionesClase SET B_isDeleted = 1 WHERE N_idExcepcion = ?`, req.ID); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	invalidarExcepciones()
+
+	evento := nuevoEvento(c, accionEliminarExcepcionClase, objetivoExcepcionClase, strconv.Itoa(x.N_idExcepcion))
+	evento.UsuarioID = idUsuarioPorCodigo(claims.UserID)
+	evento.Antes = x
+	evento.Descripcion = "Se eliminó una excepción de clase: " +
+		" | ID: " + strconv.Itoa(x.N_idExcepcion) +
+		" | NRC: " + x.T_nrc +
+		" | Fecha: " + x.Dt_fecha
+	registrarEvento(evento)
+
+	go avisarInscritos(x.N_idPeriodoAcademico, x.T_nrc,
+		"Clase restablecida: NRC "+x.T_nrc,
+		"La sesión del "+x.Dt_fecha+" del NRC "+x.T_nrc+" se dicta en su fecha, hora y salón habituales.")
+
+	c.JSON(200, gin.H{
+		"message": "Excepción eliminada correctamente",
+	})
+}
+
+// Periodo activo para registrar días sin clase o excepciones; responde 404 si no existe
+func periodoParaExcepcion(c *gin.Context, idPeriodo int) (*AcademicPeriod, bool) {
+	periodo := instantaneaPeriodo(idPeriodo)
+	if periodo == nil || periodo.B_isDeleted != 0 {
+		c.JSON(404, gin.H{"error": "Periodo académico no encontrado"})
+		return nil, false
+	}
+	return periodo, true
+}
+
+func dentroDePeriodo(periodo *AcademicPeriod, fecha time.Time) bool {
+	inicio, err1 := leerFechaBD(periodo.Dt_fechaInicio)
+	fin, err2 := leerFechaBD(periodo.Dt_fechaFinal)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return !fecha.Before(inicio) && !fecha.After(fin)
+}
+
+func rangoTexto(inicio, fin string) string {
+	if inicio == fin {
+		return "el " + inicio
+	}
+	return "del " + inicio + " al " + fin
+}
+
+func avisoExcepcion(x ExcepcionClase, curso string) (string, string) {
+	if x.T_tipo == excepcionCancelada {
+		return "Clase cancelada: " + curso,
+			fmt.Sprintf("La sesión del %s de %s (NRC %s) fue cancelada. Motivo: %s.", x.Dt_fecha, curso, x.T_nrc, x.T_motivo)
+	}
+
+	var cambios []string
+	if x.Dt_nuevaFecha != nil {
+		cambios = append(cambios, "el "+*x.Dt_nuevaFecha)
+	}
+	if x.T_horaInicio != nil {
+		cambios = append(cambios, "de "+recortarHora(*x.T_horaInicio)+" a "+recortarHora(*x.T_horaFin))
+	}
+	if x.T_salon != nil {
+		cambios = append(cambios, "en el salón "+*x.T_salon)
+	}
+	return "Clase reprogramada: " + curso,
+		fmt.Sprintf("La sesión del %s de %s (NRC %s) se reprogramó para %s. Motivo: %s.", x.Dt_fecha, curso, x.T_nrc, strings.Join(cambios, " "), x.T_motivo)
+}
+
+func recortarHora(valor string) string {
+	if len(valor) > 5 {
+		return valor[:5]
+	}
+	return valor
+}
+
+// Encola un correo a cada usuario con clases del periodo (y del NRC, si se indica)
+// e invalida su feed de calendario. Se ejecuta en segundo plano. No crea
+// Notificaciones: esas van ligadas a un recordatorio y no a un usuario.
+func avisarInscritos(idPeriodo int, nrc, asunto, contenido string) {
+	clases, err := clasesOficialesDePeriodo(idPeriodo, nrc)
+	if err != nil {
+		log.Printf("Database error buscando inscritos del periodo %d: %v", idPeriodo, err)
+		return
+	}
+
+	avisados := map[int]bool{}
+	for _, clase := range clases {
+		if avisados[clase.N_iduser] {
+			continue
+		}
+		avisados[clase.N_iduser] = true
+		invalidarCalendario(clase.codUsuario)
+		if err := encolarCorreo(clase.N_iduser, asunto, contenido); err != nil {
+			log.Printf("Error encolando aviso de excepción al usuario %d: %v", clase.N_iduser, err)
+		}
+	}
+}
+
+// Clases oficiales de todos los usuarios en un periodo; nrc vacío no filtra por NRC
+func clasesOficialesDePeriodo(idPeriodo int, nrc string) ([]claseInscrita, error) {
+	consulta := `SELECT u.T_codUsuario, ao.* FROM ActividadesOficiales ao JOIN Usuarios u ON ao.N_idUsuario = u.N_idUsuario WHERE ao.N_idPeriodoAcademico = ?`
+	args := []any{idPeriodo}
+	if nrc != "" {
+		consulta += ` AND ao.Nrc = ?`
+		args = append(args, nrc)
+	}
+
+	rows, err := db.Query(consulta, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clases []claseInscrita
+	for rows.Next() {
+		var clase claseInscrita
+		if err := rows.Scan(append([]any{&clase.codUsuario}, camposClaseOficial(&clase.OfficialSchedule)...)...); err != nil {
+			return nil, err
+		}
+		clases = append(clases, clase)
+	}
+	return clases, rows.Err()
+}
+
+// Días sin clase y excepciones activas, desde Redis o la base de datos
+func cargarExcepciones() (excepcionesHorario, error) {
+	var e excepcionesHorario
+
+	val, err := rdb.Get(ctx, claveExcepciones).Result()
+	if err == nil {
+		if json.Unmarshal([]byte(val), &e) == nil {
+			return e, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("Error de Redis leyendo excepciones: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT N_idDiaSinClase, N_idPeriodoAcademico, Dt_fechaInicio, Dt_fechaFinal, T_tipo, T_motivo FROM DiasSinClase WHERE B_isDeleted = 0 ORDER BY Dt_fechaInicio`)
+	if err != nil {
+		return e, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DiaSinClase
+		if err := rows.Scan(&d.N_idDiaSinClase, &d.N_idPeriodoAcademico, &d.Dt_fechaInicio, &d.Dt_fechaFinal, &d.T_tipo, &d.T_motivo); err != nil {
+			return e, err
+		}
+		e.SinClase = append(e.SinClase, d)
+	}
+	if err := rows.Err(); err != nil {
+		return e, err
+	}
+
+	rows2, err := db.Query(`SELECT N_idExcepcion, N_idPeriodoAcademico, T_nrc, Dt_fecha, T_tipo, Dt_nuevaFecha, T_horaInicio, T_horaFin, T_salon, T_motivo FROM ExcepcionesClase WHERE B_isDeleted = 0 ORDER BY Dt_fecha`)
+	if err != nil {
+		return e, err
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var x ExcepcionClase
+		if err := rows2.Scan(&x.N_idExcepcion, &x.N_idPeriodoAcademico, &x.T_nrc, &x.Dt_fecha, &x.T_tipo, &x.Dt_nuevaFecha, &x.T_horaInicio, &x.T_horaFin, &x.T_salon, &x.T_motivo); err != nil {
+			return e, err
+		}
+		e.Clases = append(e.Clases, x)
+	}
+	if err := rows2.Err(); err != nil {
+		return e, err
+	}
+
+	if datos, err := json.Marshal(e); err == nil {
+		if err := rdb.Set(ctx, claveExcepciones, datos, vigenciaExcepciones).Err(); err != nil {
+			log.Printf("Error de Redis guardando excepciones: %v", err)
+		}
+	}
+	return e, nil
+}
+
+func invalidarExcepciones() {
+	if err := rdb.Del(ctx, claveExcepciones).Err(); err != nil {
+		log.Printf("Error de Redis invalidando excepciones: %v", err)
+	}
+}
+
+// Aplica a una clase oficial los días sin clase de su periodo y las excepciones de
+// su NRC: esas fechas se omiten y cada reprogramación se agrega como un bloque de un
+// solo día. El primer bloque devuelto es siempre la clase.
+func (e excepcionesHorario) aplicar(b BloqueHorario) []BloqueHorario {
+	bloques := []BloqueHorario{b}
+	if b.Tipo != bloqueOficial {
+		return bloques
+	}
+
+	omitir := map[string]bool{}
+	for _, d := range e.SinClase {
+		if d.N_idPeriodoAcademico != b.idPeriodo {
+			continue
+		}
+		inicio, err1 := leerFechaBD(d.Dt_fechaInicio)
+		fin, err2 := leerFechaBD(d.Dt_fechaFinal)
+		if err1 != nil || err2 != nil {
+			log.Printf("Día sin clase %d con fechas inválidas, se ignora", d.N_idDiaSinClase)
+			continue
+		}
+		for _, fecha := range b.fechas(inicio, fin) {
+			omitir[fecha.Format(time.DateOnly)] = true
+		}
+	}
+
+	for i, x := range e.Clases {
+		if x.N_idPeriodoAcademico != b.idPeriodo || x.T_nrc != b.nrc {
+			continue
+		}
+		fecha, err := leerFechaBD(x.Dt_fecha)
+		if err != nil || !b.ocurreEn(fecha) {
+			continue
+		}
+		omitir[fecha.Format(time.DateOnly)] = true
+		if x.T_tipo == excepcionReprogramada {
+			if m, ok := reprogramar(b, fecha, &e.Clases[i]); ok {
+				bloques = append(bloques, m)
+			}
+		}
+	}
+
+	if len(omitir) > 0 {
+		bloques[0].omitir = omitir
+	}
+	return bloques
+}
+
+// Sesión reprogramada: la clase en la nueva fecha (o la misma) con las nuevas horas,
+// si las hay. No se le aplican los días sin clase.
+func reprogramar(b BloqueHorario, fecha time.Time, x *ExcepcionClase) (BloqueHorario, bool) {
+	m := b
+	m.Excepcion = x
+	m.omitir = nil
+
+	nueva := fecha
+	if x.Dt_nuevaFecha != nil {
+		t, err := leerFechaBD(*x.Dt_nuevaFecha)
+		if err != nil {
+			log.Printf("Excepción %d con nuevaFecha inválida, se ignora", x.N_idExcepcion)
+			return m, false
+		}
+		nueva = t
+	}
+	if x.T_horaInicio != nil && x.T_horaFin != nil {
+		inicio, err1 := leerHoraBD(*x.T_horaInicio)
+		fin, err2 := leerHoraBD(*x.T_horaFin)
+		if err1 != nil || err2 != nil || fin <= inicio {
+			log.Printf("Excepción %d con horas inválidas, se ignora", x.N_idExcepcion)
+			return m, false
+		}
+		m.inicio, m.fin = inicio, fin
+		m.HoraInicio, m.HoraFin = *x.T_horaInicio, *x.T_horaFin
+	}
+
+	dia := nueva.Format(time.DateOnly)
+	m.Dia = diaHorario(nueva.Weekday())
+	m.FechaInicio, m.FechaFin = &dia, &dia
+	m.desde, m.hasta = &nueva, &nueva
+	return m, true
+}
+
+// Fechas omitidas del bloque, en orden
+func (b BloqueHorario) fechasOmitidas() []time.Time {
+	var fechas []time.Time
+	for valor := range b.omitir {
+		if t, err := leerFechaBD(valor); err == nil {
+			fechas = append(fechas, t)
+		}
+	}
+	slices.SortFunc(fechas, func(a, b time.Time) int { return a.Compare(b) })
+	return fechas
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ FRANJAS LIBRES ------------------------ //
+
+const (
+	rangoLibres    = 7 // días por defecto
+	rangoMaxLibres = 62
+)
+
+// Intervalo concreto de tiempo, con fecha y hora en zonaInstitucion
+type intervalo struct {
+	inicio, fin time.Time
+}
+
+type FranjaLibre struct {
+	Fecha      string `json:"fecha"`
+	Dia        int    `json:"dia"`
+	HoraInicio string `json:"horaInicio"`
+	HoraFin    string `json:"horaFin"`
+	Minutos    int    `json:"minutos"`
+}
+
+// Parámetros de búsqueda; las horas son desfases desde la medianoche
+type busquedaLibres struct {
+	duracion      time.Duration
+	margen        time.Duration
+	desdeHora     time.Duration
+	hastaHora     time.Duration
+	dias          []int
+	recordatorios bool
+	duracionRec   time.Duration
+}
+
+func leerBusquedaLibres(c *gin.Context) (busquedaLibres, string) {
+	b := busquedaLibres{
+		duracion:    time.Hour,
+		margen:      10 * time.Minute,
+		desdeHora:   6 * time.Hour,
+		hastaHora:   22 * time.Hour,
+		duracionRec: 30 * time.Minute,
+	}
+
+	minutos := func(nombre string, destino *time.Duration, minimo int) string {
+		valor := c.Query(nombre)
+		if valor == "" {
+			return ""
+		}
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < minimo || n > 24*60 {
+			return fmt.Sprintf("%s debe ser un número de minutos entre %d y %d", nombre, minimo, 24*60)
+		}
+		*destino = time.Duration(n) * time.Minute
+		return ""
+	}
+	if msg := minutos("duration", &b.duracion, 1); msg != "" {
+		return b, msg
+	}
+	if msg := minutos("buffer", &b.margen, 0); msg != "" {
+		return b, msg
+	}
+	if msg := minutos("reminderMinutes", &b.duracionRec, 0); msg != "" {
+		return b, msg
+	}
+
+	for nombre, destino := range map[string]*time.Duration{"start": &b.desdeHora, "end": &b.hastaHora} {
+		if valor := c.Query(nombre); valor != "" {
+			hora, err := leerHoraBD(valor)
+			if err != nil {
+				return b, nombre + " debe ser HH:MM"
+			}
+			*destino = hora
+		}
+	}
+	// 24:00 no se puede escribir con HH:MM, 00:00 como fin se entiende como medianoche
+	if c.Query("end") == "00:00" {
+		b.hastaHora = 24 * time.Hour
+	}
+	if b.hastaHora <= b.desdeHora {
+		return b, "end debe ser posterior a start"
+	}
+
+	if valor := c.Query("days"); valor != "" {
+		for _, parte := range strings.Split(valor, ",") {
+			dia, err := strconv.Atoi(strings.TrimSpace(parte))
+			if err != nil || dia < 1 || dia > 7 {
+				return b, "days debe ser una lista de días entre 1 (lunes) y 7 (domingo)"
+			}
+			b.dias = append(b.dias, dia)
+		}
+	}
+
+	b.recordatorios = c.Query("reminders") == "true"
+	return b, ""
+}
+
+// Franjas libres del usuario entre from y to que duran al menos duration minutos
+func getFreeSlots(c *gin.Context) {
+	codUsuario := c.Param("id")
+
+	desde, hasta, msg := leerRangoFechas(c, rangoLibres, rangoMaxLibres)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	busqueda, msg := leerBusquedaLibres(c)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	bloques, err := bloquesUsuario(codUsuario)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var ocupados []intervalo
+	if busqueda.recordatorios {
+		recordatorios, err := recordatoriosDeUsuario(codUsuario)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		ocupados = intervalosRecordatorios(recordatorios, busqueda.duracionRec)
+	}
+
+	c.JSON(200, gin.H{
+		"from":     desde.Format(time.DateOnly),
+		"to":       hasta.Format(time.DateOnly),
+		"duration": int(busqueda.duracion.Minutes()),
+		"buffer":   int(busqueda.margen.Minutes()),
+		"slots":    franjasLibres(bloques, ocupados, desde, hasta, busqueda, time.Now().In(zonaInstitucion)),
+	})
+}
+
+// Recorre los días del rango y resta a la ventana de cada día las clases,
+// actividades y recordatorios, ampliados con el margen
+func franjasLibres(bloques []BloqueHorario, extra []intervalo, desde, hasta time.Time, b busquedaLibres, ahora time.Time) []FranjaLibre {
+	franjas := []FranjaLibre{}
+
+	for fecha := desde; !fecha.After(hasta); fecha = fecha.AddDate(0, 0, 1) {
+		dia := diaHorario(fecha.Weekday())
+		if len(b.dias) > 0 && !slices.Contains(b.dias, dia) {
+			continue
+		}
+
+		ventana := intervalo{fecha.Add(b.desdeHora), fecha.Add(b.hastaHora)}
+		if ventana.inicio.Before(ahora) {
+			ventana.inicio = ahora.Truncate(time.Minute)
+		}
+		if !ventana.fin.After(ventana.inicio) {
+			continue
+		}
+
+		ocupados := ocupadosEn(bloques, fecha)
+		for _, o := range extra {
+			if o.fin.After(ventana.inicio) && o.inicio.Before(ventana.fin) {
+				ocupados = append(ocupados, o)
+			}
+		}
+
+		for _, libre := range restarIntervalos(ventana, ocupados, b.margen) {
+			if libre.fin.Sub(libre.inicio) < b.duracion {
+				continue
+			}
+			franjas = append(franjas, FranjaLibre{
+				Fecha:      fecha.Format(time.DateOnly),
+				Dia:        dia,
+				HoraInicio: formatoHora(libre.inicio.Sub(fecha)),
+				HoraFin:    formatoHora(libre.fin.Sub(fecha)),
+				Minutos:    int(libre.fin.Sub(libre.inicio).Minutes()),
+			})
+		}
+	}
+	return franjas
+}
+
+// Ocurrencias de los bloques en la fecha como intervalos concretos
+func ocupadosEn(bloques []BloqueHorario, fecha time.Time) []intervalo {
+	var ocupados []intervalo
+	for _, b := range bloques {
+		if b.ocurreEn(fecha) {
+			ocupados = append(ocupados, intervalo{fecha.Add(b.inicio), fecha.Add(b.fin)})
+		}
+	}
+	return ocupados
+}
+
+// Lo que queda de la ventana al quitar los ocupados, cada uno ampliado en margen por ambos lados
+func restarIntervalos(ventana intervalo, ocupados []intervalo, margen time.Duration) []intervalo {
+	slices.SortFunc(ocupados, func(a, b intervalo) int {
+		return a.inicio.Compare(b.inicio)
+	})
+
+	var libres []intervalo
+	cursor := ventana.inicio
+	for _, o := range ocupados {
+		inicio, fin := o.inicio.Add(-margen), o.fin.Add(margen)
+		if inicio.After(cursor) {
+			libres = append(libres, intervalo{cursor, minTiempo(inicio, ventana.fin)})
+		}
+		if fin.After(cursor) {
+			cursor = fin
+		}
+		if !cursor.Before(ventana.fin) {
+			return libres
+		}
+	}
+	return append(libres, intervalo{cursor, ventana.fin})
+}
+
+// Los recordatorios pendientes con hora ocupan duracion antes del vencimiento.
+// Los que solo tienen fecha (medianoche) no bloquean tiempo.
+func intervalosRecordatorios(recordatorios []Reminders, duracion time.Duration) []intervalo {
+	var ocupados []intervalo
+	if duracion == 0 {
+		return ocupados
+	}
+	for _, r := range recordatorios {
+		if eliminado(r.B_isDeleted) || (r.B_estado != nil && *r.B_estado) || !r.Dt_fechaVencimiento.Valid {
+			continue
+		}
+		vence, todoElDia, err := vencimientoRecordatorio(r)
+		if err != nil || todoElDia {
+			continue
+		}
+		ocupados = append(ocupados, intervalo{vence.Add(-duracion), vence})
+	}
+	return ocupados
+}
+
+func minTiempo(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
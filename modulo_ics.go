@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // La imagen de Docker (alpine) no trae la base de zonas horarias
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ EXPORTACIÓN ICALENDAR ------------------------ //
+
+// Zona horaria en la que están guardadas las horas de clase y actividades
+var zonaInstitucion *time.Location
+
+func cargarZonaInstitucion() *time.Location {
+	nombre := os.Getenv("TZ_INSTITUCION")
+	if nombre == "" {
+		nombre = "America/Bogota"
+	}
+
+	zona, err := time.LoadLocation(nombre)
+	if err != nil {
+		log.Fatalf("TZ_INSTITUCION inválida %s: %v", nombre, err)
+	}
+	return zona
+}
+
+// Qué partes del horario se incluyen en el calendario
+type incluirCalendario struct {
+	oficial       bool
+	personal      bool
+	recordatorios bool
+}
+
+// include=official,personal,reminders (por defecto todo)
+func leerIncluirCalendario(valor string) (incluirCalendario, bool) {
+	if valor == "" {
+		return incluirCalendario{true, true, true}, true
+	}
+
+	var inc incluirCalendario
+	for _, parte := range strings.Split(valor, ",") {
+		switch strings.TrimSpace(parte) {
+		case "official":
+			inc.oficial = true
+		case "personal":
+			inc.personal = true
+		case "reminders":
+			inc.recordatorios = true
+		default:
+			return inc, false
+		}
+	}
+	return inc, true
+}
+
+// Descarga el horario combinado del usuario como archivo .ics
+func exportScheduleICS(c *gin.Context) {
+	codUsuario := c.Param("id")
+
+	inc, ok := leerIncluirCalendario(c.Query("include"))
+	if !ok {
+		c.JSON(400, gin.H{"error": "include debe ser una lista de official, personal y reminders"})
+		return
+	}
+
+	datos, err := consultarCalendario(codUsuario, inc)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="horario-`+codUsuario+`.ics"`)
+	c.Data(200, "text/calendar; charset=utf-8", datos.ics(time.Now()))
+}
+
+// Lo que entra en el calendario de un usuario
+type datosCalendario struct {
+	clases        []OfficialSchedule
+	actividades   []PersonalSchedule
+	recordatorios []Reminders
+
+	// Días sin clase y excepciones que se aplican a las clases
+	excepciones excepcionesHorario
+}
+
+func consultarCalendario(codUsuario string, inc incluirCalendario) (datosCalendario, error) {
+	var datos datosCalendario
+	var err error
+
+	if inc.oficial {
+		if datos.clases, err = consultarHorarioOficial(codUsuario); err != nil {
+			return datos, err
+		}
+		if datos.excepciones, err = cargarExcepciones(); err != nil {
+			return datos, err
+		}
+	}
+	if inc.personal {
+		if datos.actividades, err = consultarActividadesPersonales(codUsuario); err != nil {
+			return datos, err
+		}
+	}
+	if inc.recordatorios {
+		if datos.recordatorios, err = recordatoriosDeUsuario(codUsuario); err != nil {
+			return datos, err
+		}
+	}
+	return datos, nil
+}
+
+// Arma el VCALENDAR con las clases y actividades como eventos semanales
+// y los recordatorios con fecha como VTODO. Con los mismos datos y la misma
+// marca de tiempo el resultado es idéntico (lo usa el ETag del feed).
+func (d datosCalendario) ics(stamp time.Time) []byte {
+	ics := nuevoICS(zonaInstitucion, stamp)
+	for _, clase := range d.clases {
+		ics.clase(clase, d.excepciones)
+	}
+	for _, actividad := range d.actividades {
+		ics.actividad(actividad)
+	}
+	for _, recordatorio := range d.recordatorios {
+		ics.recordatorio(recordatorio)
+	}
+	return ics.terminar()
+}
+
+// Escritor de iCalendar (RFC 5545): líneas con CRLF, plegadas a 75 octetos
+type escritorICS struct {
+	b     strings.Builder
+	zona  *time.Location
+	stamp time.Time
+}
+
+func nuevoICS(zona *time.Location, stamp time.Time) *escritorICS {
+	e := &escritorICS{zona: zona, stamp: stamp}
+
+	e.linea("BEGIN:VCALENDAR")
+	e.linea("VERSION:2.0")
+	e.linea("PRODID:-//UPB Planner//Horario//ES")
+	e.linea("CALSCALE:GREGORIAN")
+	e.linea("METHOD:PUBLISH")
+	e.linea("X-WR-CALNAME:" + escaparICS("Horario UPB"))
+	e.linea("X-WR-TIMEZONE:" + zona.String())
+	e.zonaHoraria()
+	return e
+}
+
+func (e *escritorICS) terminar() []byte {
+	e.linea("END:VCALENDAR")
+	return []byte(e.b.String())
+}
+
+func (e *escritorICS) linea(texto string) {
+	// Se pliega sin partir caracteres UTF-8; la continuación empieza con un espacio
+	limite := 75
+	for len(texto) > limite {
+		corte := limite
+		for corte > 0 && !inicioRuna(texto[corte]) {
+			corte--
+		}
+		e.b.WriteString(texto[:corte])
+		e.b.WriteString("\r\n ")
+		texto = texto[corte:]
+		limite = 74
+	}
+	e.b.WriteString(texto)
+	e.b.WriteString("\r\n")
+}
+
+func inicioRuna(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// VTIMEZONE solo para zonas sin horario de verano (como America/Bogota).
+// Para las demás se deja el TZID de la base IANA, que los clientes de calendario reconocen.
+func (e *escritorICS) zonaHoraria() {
+	anio := e.stamp.Year()
+	_, enero := time.Date(anio, 1, 1, 0, 0, 0, 0, e.zona).Zone()
+	_, julio := time.Date(anio, 7, 1, 0, 0, 0, 0, e.zona).Zone()
+	if enero != julio {
+		return
+	}
+
+	nombre, _ := time.Date(anio, 1, 1, 0, 0, 0, 0, e.zona).Zone()
+	desfase := desfaseICS(enero)
+
+	e.linea("BEGIN:VTIMEZONE")
+	e.linea("TZID:" + e.zona.String())
+	e.linea("BEGIN:STANDARD")
+	e.linea("DTSTART:19700101T000000")
+	e.linea("TZOFFSETFROM:" + desfase)
+	e.linea("TZOFFSETTO:" + desfase)
+	e.linea("TZNAME:" + escaparICS(nombre))
+	e.linea("END:STANDARD")
+	e.linea("END:VTIMEZONE")
+}
+
+func desfaseICS(segundos int) string {
+	signo := "+"
+	if segundos < 0 {
+		signo = "-"
+		segundos = -segundos
+	}
+	return fmt.Sprintf("%s%02d%02d", signo, segundos/3600, segundos%3600/60)
+}
+
+// Clase oficial: evento semanal entre FechaInicio y FechaFinal del periodo. Los días sin
+// clase y las sesiones canceladas van como EXDATE y cada reprogramación como evento aparte.
+func (e *escritorICS) clase(clase OfficialSchedule, excepciones excepcionesHorario) {
+	desde, err1 := leerFechaBD(clase.FechaInicio)
+	hasta, err2 := leerFechaBD(clase.FechaFinal)
+	if err1 != nil || err2 != nil {
+		log.Printf("Clase %d sin fechas de periodo válidas, se omite del calendario", clase.N_idHorario)
+		return
+	}
+
+	var descripcion []string
+	if clase.Nrc != "" {
+		descripcion = append(descripcion, "NRC: "+clase.Nrc)
+	}
+	if clase.Teacher != "" {
+		descripcion = append(descripcion, "Docente: "+clase.Teacher)
+	}
+	if clase.Periodo_academico != "" {
+		descripcion = append(descripcion, "Periodo: "+clase.Periodo_academico)
+	}
+
+	lugar := func(salon string) string {
+		if clase.Campus != "" {
+			return strings.TrimSpace(salon + " - " + clase.Campus)
+		}
+		return salon
+	}
+
+	uid := fmt.Sprintf("oficial-%d-%d-%d-%s", clase.N_idHorario, clase.N_idcourse, clase.Day, strings.ReplaceAll(clase.StartHour, ":", ""))
+	var excluir []time.Time
+	if b, err := bloqueClase(clase); err == nil {
+		bloques := excepciones.aplicar(b)
+		excluir = bloques[0].fechasOmitidas()
+		for _, m := range bloques[1:] {
+			x := m.Excepcion
+			salon := clase.Classroom
+			if x.T_salon != nil {
+				salon = *x.T_salon
+			}
+			nota := append(slices.Clone(descripcion), "Reprogramada desde el "+x.Dt_fecha+": "+x.T_motivo)
+			e.eventoSemanal(
+				fmt.Sprintf("%s-r%d", uid, x.N_idExcepcion),
+				clase.Course, strings.Join(nota, "\n"), lugar(salon), clase.Tag,
+				m.Dia, m.HoraInicio, m.HoraFin, *m.desde, m.hasta, nil,
+			)
+		}
+	}
+
+	e.eventoSemanal(
+		uid,
+		clase.Course, strings.Join(descripcion, "\n"), lugar(clase.Classroom), clase.Tag,
+		clase.Day, clase.StartHour, clase.EndHour, desde, &hasta, excluir,
+	)
+}
+
+// Actividad personal: evento semanal; sin fechas se repite desde la semana del calendario y sin fin
+func (e *escritorICS) actividad(actividad PersonalSchedule) {
+	if actividad.IsDeleted != nil && actividad.IsDeleted.Valid && actividad.IsDeleted.Bool {
+		return
+	}
+
+	desde := e.stamp.In(e.zona)
+	if actividad.Dt_Start.Valid {
+		if t, err := leerFechaBD(actividad.Dt_Start.String); err == nil {
+			desde = t
+		}
+	}
+	var hasta *time.Time
+	if actividad.Dt_End.Valid {
+		if t, err := leerFechaBD(actividad.Dt_End.String); err == nil {
+			hasta = &t
+		}
+	}
+
+	e.eventoSemanal(
+		fmt.Sprintf("personal-%d", actividad.N_idcourse),
+		actividad.Activity, actividad.Description.String, "", "Personal",
+		actividad.Day, actividad.StartHour, actividad.EndHour, desde, hasta, nil,
+	)
+}
+
+// excluir son fechas (medianoche) en que no ocurre, se escriben como EXDATE
+func (e *escritorICS) eventoSemanal(uid, titulo, descripcion, lugar, categoria string, dia int, horaInicio, horaFin string, desde time.Time, hasta *time.Time, excluir []time.Time) {
+	diaSemana, ok := diaSemanaHorario(dia)
+	inicio, err1 := leerHoraBD(horaInicio)
+	fin, err2 := leerHoraBD(horaFin)
+	if !ok || err1 != nil || err2 != nil {
+		log.Printf("Evento %s con día u horas inválidos, se omite del calendario", uid)
+		return
+	}
+
+	// Primera ocurrencia: el primer día de la semana correspondiente desde "desde"
+	primera := time.Date(desde.Year(), desde.Month(), desde.Day(), 0, 0, 0, 0, e.zona)
+	primera = primera.AddDate(0, 0, (int(diaSemana)-int(primera.Weekday())+7)%7)
+	if hasta != nil && primera.After(*hasta) {
+		return
+	}
+
+	e.linea("BEGIN:VEVENT")
+	e.linea("UID:" + uid + "@upb-planner")
+	e.linea("DTSTAMP:" + e.stamp.UTC().Format("20060102T150405Z"))
+	e.linea("DTSTART;TZID=" + e.zona.String() + ":" + primera.Add(inicio).Format("20060102T150405"))
+	e.linea("DTEND;TZID=" + e.zona.String() + ":" + primera.Add(fin).Format("20060102T150405"))
+
+	regla := "RRULE:FREQ=WEEKLY;BYDAY=" + diasICS[diaSemana]
+	if hasta != nil {
+		// UNTIL en UTC e inclusivo: hasta el final del último día
+		ultimo := time.Date(hasta.Year(), hasta.Month(), hasta.Day(), 23, 59, 59, 0, e.zona)
+		regla += ";UNTIL=" + ultimo.UTC().Format("20060102T150405Z")
+	}
+	e.linea(regla)
+	if len(excluir) > 0 {
+		fechas := make([]string, len(excluir))
+		for i, fecha := range excluir {
+			fechas[i] = time.Date(fecha.Year(), fecha.Month(), fecha.Day(), 0, 0, 0, 0, e.zona).Add(inicio).Format("20060102T150405")
+		}
+		e.linea("EXDATE;TZID=" + e.zona.String() + ":" + strings.Join(fechas, ","))
+	}
+
+	e.linea("SUMMARY:" + escaparICS(titulo))
+	if descripcion != "" {
+		e.linea("DESCRIPTION:" + escaparICS(descripcion))
+	}
+	if lugar != "" {
+		e.linea("LOCATION:" + escaparICS(lugar))
+	}
+	if categoria != "" {
+		e.linea("CATEGORIES:" + escaparICS(categoria))
+	}
+	e.linea("END:VEVENT")
+}
+
+// Recordatorio con fecha de vencimiento: VTODO con DUE
+func (e *escritorICS) recordatorio(r Reminders) {
+	if (r.B_isDeleted != nil && *r.B_isDeleted) || !r.Dt_fechaVencimiento.Valid {
+		return
+	}
+
+	// Sin hora o a medianoche es de todo el día, igual que en /calendar
+	vence, todoElDia, err := vencimientoRecordatorio(r)
+	if err != nil {
+		log.Printf("Recordatorio %d con fecha inválida, se omite del calendario", r.N_idRecordatorio)
+		return
+	}
+	due := "DUE;TZID=" + e.zona.String() + ":" + vence.In(e.zona).Format("20060102T150405")
+	if todoElDia {
+		due = "DUE;VALUE=DATE:" + vence.Format("20060102")
+	}
+
+	e.linea("BEGIN:VTODO")
+	e.linea(fmt.Sprintf("UID:recordatorio-%d@upb-planner", r.N_idRecordatorio))
+	e.linea("DTSTAMP:" + e.stamp.UTC().Format("20060102T150405Z"))
+	e.linea(due)
+
+	e.linea("SUMMARY:" + escaparICS(r.T_nombre))
+	if r.T_descripcion.Valid && r.T_descripcion.String != "" {
+		e.linea("DESCRIPTION:" + escaparICS(r.T_descripcion.String))
+	}
+	if prioridad := prioridadICS(r.T_Prioridad); prioridad > 0 {
+		e.linea(fmt.Sprintf("PRIORITY:%d", prioridad))
+	}
+	if r.B_estado != nil && *r.B_estado {
+		e.linea("STATUS:COMPLETED")
+	} else {
+		e.linea("STATUS:NEEDS-ACTION")
+	}
+	e.linea("END:VTODO")
+}
+
+// Prioridad del recordatorio en la escala de iCalendar (1 alta, 9 baja)
+func prioridadICS(prioridad string) int {
+	switch strings.ToLower(strings.TrimSpace(prioridad)) {
+	case "alta", "1":
+		return 1
+	case "media", "2":
+		return 5
+	case "baja", "3":
+		return 9
+	}
+	return 0
+}
+
+var diasICS = map[time.Weekday]string{
+	time.Monday: "MO", time.Tuesday: "TU", time.Wednesday: "WE", time.Thursday: "TH",
+	time.Friday: "FR", time.Saturday: "SA", time.Sunday: "SU",
+}
+
+// En las tablas de horario el día va de 1 (lunes) a 7 (domingo)
+func diaSemanaHorario(dia int) (time.Weekday, bool) {
+	if dia < 1 || dia > 7 {
+		return 0, false
+	}
+	return time.Weekday(dia % 7), true
+}
+
+// Fechas de MySQL: "2025-02-03", "2025-02-03 00:00:00" o RFC3339
+func leerFechaBD(valor string) (time.Time, error) {
+	if len(valor) >= 10 {
+		valor = valor[:10]
+	}
+	return time.ParseInLocation(time.DateOnly, valor, zonaInstitucion)
+}
+
+// Horas de MySQL ("07:00:00" o "07:00") como desfase desde la medianoche
+func leerHoraBD(valor string) (time.Duration, error) {
+	t, err := time.Parse(time.TimeOnly, valor)
+	if err != nil {
+		t, err = time.Parse("15:04", valor)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+}
+
+func escaparICS(texto string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(texto)
+}
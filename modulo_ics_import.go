@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ IMPORTACIÓN ICALENDAR ------------------------ //
+
+const (
+	tamMaxICS     = 1 << 20 // 1 MB
+	eventosMaxICS = 500
+)
+
+// Un COUNT mayor que el límite de eventos rechaza el archivo completo
+var errConteoICS = fmt.Errorf("COUNT no puede pasar de %d repeticiones", eventosMaxICS)
+
+// Un VEVENT leído del archivo, con los valores tal como vienen
+type eventoICS struct {
+	linea       int
+	uid         string
+	resumen     string
+	descripcion string
+	inicio      string
+	fin         string
+	inicioZona  string
+	duracion    string
+	regla       string
+}
+
+// Actividad personal que resulta de un evento (una por día de la semana)
+type actividadICS struct {
+	UID         string  `json:"uid"`
+	Nombre      string  `json:"nombre"`
+	Descripcion string  `json:"descripcion,omitempty"`
+	Dia         int     `json:"dia"`
+	HoraInicio  string  `json:"horaInicio"`
+	HoraFin     string  `json:"horaFin"`
+	FechaInicio string  `json:"fechaInicio"`
+	FechaFin    *string `json:"fechaFin"`
+	ID          int     `json:"id,omitempty"`
+}
+
+type errorICS struct {
+	UID     string `json:"uid,omitempty"`
+	Linea   int    `json:"linea"`
+	Resumen string `json:"resumen,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Sube un .ics (multipart, campo "file") y crea actividades personales con sus eventos.
+// Con preview=true solo devuelve lo que se crearía.
+func importPersonalICS(c *gin.Context) {
+	codUsuario := c.PostForm("codUsuario")
+	if !AuthorityCheck(codUsuario, c) {
+		c.AbortWithStatusJSON(401, gin.H{"error": "Autorización requerida"})
+		return
+	}
+	preview := c.PostForm("preview") == "true" || c.Query("preview") == "true"
+
+	archivo, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Se requiere el archivo .ics en el campo file"})
+		return
+	}
+	if archivo.Size > tamMaxICS {
+		c.JSON(413, gin.H{"error": "El archivo supera 1 MB"})
+		return
+	}
+
+	f, err := archivo.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "No se pudo leer el archivo"})
+		return
+	}
+	defer f.Close()
+
+	eventos, err := leerEventosICS(io.LimitReader(f, tamMaxICS))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(eventos) > eventosMaxICS {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("El archivo tiene más de %d eventos", eventosMaxICS)})
+		return
+	}
+
+	usuarioID := idUsuarioPorCodigo(codUsuario)
+	if usuarioID == 0 {
+		c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	existentes, err := consultarActividadesPersonales(codUsuario)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	vistas := map[string]bool{}
+	for _, a := range existentes {
+		if a.IsDeleted != nil && a.IsDeleted.Valid && a.IsDeleted.Bool {
+			continue
+		}
+		vistas[claveActividad(a.Activity, a.Day, a.StartHour, a.EndHour)] = true
+	}
+
+	nuevas := []actividadICS{}
+	duplicadas := []actividadICS{}
+	errores := []errorICS{}
+
+	for _, ev := range eventos {
+		actividades, err := ev.actividades()
+		if errors.Is(err, errConteoICS) {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("%v (evento %s, línea %d)", err, ev.uid, ev.linea)})
+			return
+		}
+		if err != nil {
+			errores = append(errores, errorICS{UID: ev.uid, Linea: ev.linea, Resumen: ev.resumen, Error: err.Error()})
+			continue
+		}
+		for _, a := range actividades {
+			// Duplicada si ya hay una actividad con el mismo nombre, día y horas (o se repite en el archivo)
+			clave := claveActividad(a.Nombre, a.Dia, a.HoraInicio, a.HoraFin)
+			if vistas[clave] {
+				duplicadas = append(duplicadas, a)
+				continue
+			}
+			vistas[clave] = true
+			nuevas = append(nuevas, a)
+		}
+	}
+
+	if preview {
+		c.JSON(200, gin.H{
+			"preview":    true,
+			"created":    nuevas,
+			"duplicates": duplicadas,
+			"errors":     errores,
+		})
+		return
+	}
+
+	creadas := []actividadICS{}
+	for _, a := range nuevas {
+		var fechaFin interface{}
+		if a.FechaFin != nil {
+			fechaFin = *a.FechaFin
+		}
+
+		err := db.QueryRow("SELECT crear_actividad_personal(?, ?, ?, ?, ?, ?, ?, ?)",
+			usuarioID,
+			a.Nombre,
+			a.Descripcion,
+			a.FechaInicio,
+			fechaFin,
+			a.Dia,
+			a.HoraInicio,
+			a.HoraFin,
+		).Scan(&a.ID)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			errores = append(errores, errorICS{UID: a.UID, Resumen: a.Nombre, Error: "No se pudo crear la actividad"})
+			continue
+		}
+		creadas = append(creadas, a)
+	}
+
+	if len(creadas) > 0 {
+		if err := rdb.Del(ctx, "PersonalSchedule:"+codUsuario).Err(); err != nil {
+			fmt.Printf("\nError de conexión: %v", err)
+		}
+		invalidarCalendario(codUsuario)
+
+		descripcion := fmt.Sprintf("Se importaron actividades personales desde .ics | Usuario: %s | Creadas: %d | Duplicadas: %d | Errores: %d",
+			codUsuario, len(creadas), len(duplicadas), len(errores))
+
+		evento := nuevoEvento(c, accionImportarCalendario, objetivoActividad, "")
+		evento.UsuarioID = usuarioID
+		evento.Despues = creadas
+		evento.Descripcion = descripcion
+		registrarEvento(evento)
+	}
+
+	c.JSON(200, gin.H{
+		"preview":    false,
+		"created":    creadas,
+		"duplicates": duplicadas,
+		"errors":     errores,
+	})
+}
+
+func claveActividad(nombre string, dia int, inicio, fin string) string {
+	normalizar := func(h string) string {
+		if d, err := leerHoraBD(h); err == nil {
+			return d.String()
+		}
+		return h
+	}
+	return fmt.Sprintf("%s|%d|%s|%s", strings.ToLower(strings.TrimSpace(nombre)), dia, normalizar(inicio), normalizar(fin))
+}
+
+// Lee los VEVENT del archivo; las líneas plegadas se unen antes de interpretarlas
+func leerEventosICS(r io.Reader) ([]eventoICS, error) {
+	lector := bufio.NewScanner(r)
+	lector.Buffer(make([]byte, 0, 64*1024), tamMaxICS)
+
+	type lineaICS struct {
+		numero int
+		texto  string
+	}
+	var lineas []lineaICS
+	numero := 0
+	for lector.Scan() {
+		numero++
+		texto := strings.TrimRight(lector.Text(), "\r")
+		if numero == 1 {
+			texto = strings.TrimPrefix(texto, "\uFEFF")
+		}
+		if (strings.HasPrefix(texto, " ") || strings.HasPrefix(texto, "\t")) && len(lineas) > 0 {
+			lineas[len(lineas)-1].texto += texto[1:]
+			continue
+		}
+		lineas = append(lineas, lineaICS{numero, texto})
+	}
+	if err := lector.Err(); err != nil {
+		return nil, fmt.Errorf("No se pudo leer el archivo .ics")
+	}
+	if len(lineas) == 0 || !strings.EqualFold(lineas[0].texto, "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("El archivo no es un calendario .ics válido")
+	}
+
+	var eventos []eventoICS
+	var actual *eventoICS
+	anidado := 0 // VALARM y otros componentes dentro del evento
+
+	for _, l := range lineas {
+		nombre, params, valor := propiedadICS(l.texto)
+
+		switch {
+		case nombre == "BEGIN" && strings.EqualFold(valor, "VEVENT"):
+			actual = &eventoICS{linea: l.numero}
+		case nombre == "END" && strings.EqualFold(valor, "VEVENT") && actual != nil:
+			eventos = append(eventos, *actual)
+			actual = nil
+		case actual == nil:
+		case nombre == "BEGIN":
+			anidado++
+		case nombre == "END":
+			anidado--
+		case anidado > 0:
+		case nombre == "UID":
+			actual.uid = valor
+		case nombre == "SUMMARY":
+			actual.resumen = desescaparICS(valor)
+		case nombre == "DESCRIPTION":
+			actual.descripcion = desescaparICS(valor)
+		case nombre == "DTSTART":
+			actual.inicio = valor
+			actual.inicioZona = params["TZID"]
+			if strings.EqualFold(params["VALUE"], "DATE") {
+				actual.inicio = ""
+			}
+		case nombre == "DTEND":
+			actual.fin = valor
+		case nombre == "DURATION":
+			actual.duracion = valor
+		case nombre == "RRULE":
+			actual.regla = valor
+		}
+	}
+	return eventos, nil
+}
+
+// "DTSTART;TZID=America/Bogota:20250203T070000" -> DTSTART, {TZID: ...}, 20250203T070000
+func propiedadICS(linea string) (string, map[string]string, string) {
+	comillas := false
+	dosPuntos := -1
+	for i, r := range linea {
+		if r == '"' {
+			comillas = !comillas
+		} else if r == ':' && !comillas {
+			dosPuntos = i
+			break
+		}
+	}
+	if dosPuntos < 0 {
+		return strings.ToUpper(linea), nil, ""
+	}
+
+	partes := strings.Split(linea[:dosPuntos], ";")
+	params := map[string]string{}
+	for _, p := range partes[1:] {
+		if clave, valor, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(clave)] = strings.Trim(valor, `"`)
+		}
+	}
+	return strings.ToUpper(partes[0]), params, linea[dosPuntos+1:]
+}
+
+func desescaparICS(texto string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(texto)
+}
+
+// Convierte el evento en actividades semanales. Sin RRULE es una actividad de un solo día.
+func (ev eventoICS) actividades() ([]actividadICS, error) {
+	if strings.TrimSpace(ev.resumen) == "" {
+		return nil, fmt.Errorf("El evento no tiene SUMMARY")
+	}
+	if ev.inicio == "" {
+		return nil, fmt.Errorf("Los eventos de todo el día no se pueden importar como actividad")
+	}
+
+	zonaOrigen := zonaInstitucion
+	if ev.inicioZona != "" {
+		if z, err := time.LoadLocation(ev.inicioZona); err == nil {
+			zonaOrigen = z
+		}
+	}
+
+	inicioOrigen, err := leerFechaHoraICS(ev.inicio, zonaOrigen)
+	if err != nil {
+		return nil, fmt.Errorf("DTSTART inválido")
+	}
+
+	var finOrigen time.Time
+	switch {
+	case ev.fin != "":
+		if finOrigen, err = leerFechaHoraICS(ev.fin, zonaOrigen); err != nil {
+			return nil, fmt.Errorf("DTEND inválido")
+		}
+	case ev.duracion != "":
+		d, err := leerDuracionICS(ev.duracion)
+		if err != nil {
+			return nil, fmt.Errorf("DURATION inválida")
+		}
+		finOrigen = inicioOrigen.Add(d)
+	default:
+		return nil, fmt.Errorf("El evento no tiene DTEND ni DURATION")
+	}
+
+	inicio := inicioOrigen.In(zonaInstitucion)
+	fin := finOrigen.In(zonaInstitucion)
+	if !fin.After(inicio) {
+		return nil, fmt.Errorf("El evento termina antes de empezar")
+	}
+	if fin.YearDay() != inicio.YearDay() || fin.Year() != inicio.Year() {
+		if !(fin.Hour() == 0 && fin.Minute() == 0 && fin.Sub(inicio) <= 24*time.Hour) {
+			return nil, fmt.Errorf("Los eventos de varios días no se pueden importar como actividad")
+		}
+		// Termina exactamente a medianoche
+		fin = fin.Add(-time.Second)
+	}
+
+	base := actividadICS{
+		UID:         ev.uid,
+		Nombre:      strings.TrimSpace(ev.resumen),
+		Descripcion: ev.descripcion,
+		HoraInicio:  inicio.Format(time.TimeOnly),
+		HoraFin:     fin.Format(time.TimeOnly),
+		FechaInicio: inicio.Format(time.DateOnly),
+	}
+
+	if ev.regla == "" {
+		fecha := base.FechaInicio
+		base.FechaFin = &fecha
+		base.Dia = diaHorario(inicio.Weekday())
+		return []actividadICS{base}, nil
+	}
+
+	regla := map[string]string{}
+	for _, parte := range strings.Split(ev.regla, ";") {
+		if clave, valor, ok := strings.Cut(parte, "="); ok {
+			regla[strings.ToUpper(clave)] = strings.ToUpper(valor)
+		}
+	}
+
+	if regla["FREQ"] != "WEEKLY" && regla["FREQ"] != "DAILY" {
+		return nil, fmt.Errorf("Solo se pueden importar eventos semanales o diarios (RRULE FREQ=%s)", regla["FREQ"])
+	}
+	if intervalo := regla["INTERVAL"]; intervalo != "" && intervalo != "1" {
+		return nil, fmt.Errorf("No se admiten repeticiones cada %s semanas o días", intervalo)
+	}
+
+	// Días en la zona de origen; si al convertir la hora cambia de día, se corren igual
+	corrimiento := (int(inicio.Weekday()) - int(inicioOrigen.Weekday()) + 7) % 7
+	var dias []time.Weekday
+	switch {
+	case regla["BYDAY"] != "":
+		for _, codigo := range strings.Split(regla["BYDAY"], ",") {
+			dia, ok := diaDesdeICS(codigo)
+			if !ok {
+				return nil, fmt.Errorf("BYDAY inválido: %s", codigo)
+			}
+			dias = append(dias, time.Weekday((int(dia)+corrimiento)%7))
+		}
+	case regla["FREQ"] == "DAILY":
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			dias = append(dias, d)
+		}
+	default:
+		dias = []time.Weekday{inicio.Weekday()}
+	}
+
+	var fechaFin *string
+	switch {
+	case regla["UNTIL"] != "":
+		hasta, err := leerFechaHoraICS(regla["UNTIL"], zonaOrigen)
+		if err != nil {
+			return nil, fmt.Errorf("UNTIL inválido")
+		}
+		f := hasta.In(zonaInstitucion).Format(time.DateOnly)
+		fechaFin = &f
+	case regla["COUNT"] != "":
+		n, err := strconv.Atoi(regla["COUNT"])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("COUNT inválido")
+		}
+		if n > eventosMaxICS {
+			return nil, errConteoICS
+		}
+		f := ultimaOcurrencia(inicio, dias, n).Format(time.DateOnly)
+		fechaFin = &f
+	}
+
+	var actividades []actividadICS
+	for _, dia := range dias {
+		a := base
+		a.Dia = diaHorario(dia)
+		a.FechaFin = fechaFin
+		actividades = append(actividades, a)
+	}
+	return actividades, nil
+}
+
+// Fecha de la n-ésima ocurrencia contando desde el día de inicio. Cada semana
+// desde el inicio tiene una ocurrencia por día distinto, así que se saltan las
+// semanas completas y solo se recorre la última.
+func ultimaOcurrencia(inicio time.Time, dias []time.Weekday, n int) time.Time {
+	porSemana := map[time.Weekday]bool{}
+	for _, d := range dias {
+		porSemana[d] = true
+	}
+	semanas := (n - 1) / len(porSemana)
+	n -= semanas * len(porSemana)
+
+	fecha := time.Date(inicio.Year(), inicio.Month(), inicio.Day()+7*semanas, 0, 0, 0, 0, zonaInstitucion)
+	for {
+		if porSemana[fecha.Weekday()] {
+			n--
+		}
+		if n <= 0 {
+			return fecha
+		}
+		fecha = fecha.AddDate(0, 0, 1)
+	}
+}
+
+// 20250203T070000Z (UTC), 20250203T070000 (hora local de "zona") o 20250203
+func leerFechaHoraICS(valor string, zona *time.Location) (time.Time, error) {
+	if strings.HasSuffix(valor, "Z") {
+		return time.Parse("20060102T150405Z", valor)
+	}
+	if len(valor) == 8 {
+		return time.ParseInLocation("20060102", valor, zona)
+	}
+	return time.ParseInLocation("20060102T150405", valor, zona)
+}
+
+// Duraciones simples de iCalendar: PT1H30M, PT45M, P1D
+func leerDuracionICS(valor string) (time.Duration, error) {
+	v := strings.TrimPrefix(strings.ToUpper(valor), "P")
+	if v == valor || strings.HasPrefix(valor, "-") {
+		return 0, fmt.Errorf("duración inválida")
+	}
+
+	var total time.Duration
+	fechaParte, horaParte, _ := strings.Cut(v, "T")
+	for _, bloque := range []struct {
+		texto    string
+		unidades map[byte]time.Duration
+	}{
+		{fechaParte, map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}},
+		{horaParte, map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}},
+	} {
+		numero := ""
+		for i := 0; i < len(bloque.texto); i++ {
+			ch := bloque.texto[i]
+			if ch >= '0' && ch <= '9' {
+				numero += string(ch)
+				continue
+			}
+			unidad, ok := bloque.unidades[ch]
+			if !ok || numero == "" {
+				return 0, fmt.Errorf("duración inválida")
+			}
+			n, _ := strconv.Atoi(numero)
+			total += time.Duration(n) * unidad
+			numero = ""
+		}
+		if numero != "" {
+			return 0, fmt.Errorf("duración inválida")
+		}
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("duración inválida")
+	}
+	return total, nil
+}
+
+// MO..SU; se ignora el número de BYDAY (1MO) que solo aplica a reglas mensuales
+func diaDesdeICS(codigo string) (time.Weekday, bool) {
+	codigo = strings.TrimLeft(strings.TrimSpace(codigo), "+-0123456789")
+	for dia, c := range diasICS {
+		if c == codigo {
+			return dia, true
+		}
+	}
+	return 0, false
+}
+
+// Inverso de diaSemanaHorario: lunes = 1 ... domingo = 7
+func diaHorario(dia time.Weekday) int {
+	if dia == time.Sunday {
+		return 7
+	}
+	return int(dia)
+}
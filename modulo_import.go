@@ -86,6 +86,8 @@ func importSchedule(c *gin.Context) {
 		return
 
 	}
+	invalidarCalendario(newScheduleValue.CodUsuario)
+
 	descripcion := "Se importó horario del usuario: " + newScheduleValue.CodUsuario +
 		" | Curso: " + newScheduleValue.NombreCurso +
 		" | NRC: " + newScheduleValue.Nrc
@@ -100,7 +102,12 @@ func importSchedule(c *gin.Context) {
 		log.Println("Error obteniendo usuario para log:", err)
 		userID = 0
 	}
-	insertarLog(userID, "IMPORTAR_HORARIO", descripcion)
+	evento := nuevoEvento(c, accionImportarHorario, objetivoHorario, newScheduleValue.Nrc)
+	evento.UsuarioID = userID
+	evento.Despues = newScheduleValue
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
+
 	c.JSON(200, gin.H{
 		"message": "Horario importado correctamente",
 	})
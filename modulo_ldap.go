@@ -1,18 +1,19 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf16"
 
+	"gin-quickstart/internal/auth"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-ldap/ldap/v3"
 	"github.com/golang-jwt/jwt/v5"
@@ -46,34 +47,30 @@ func (j JWTManager) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// devolver los claims del usuario
-		c.Set("user_claims", claims)
-
-		// El token es válido, continúa hacia la ruta solicitada
-		c.Next()
-	}
-}
-
-func RoleMiddleware(requiredRole string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Extraemos lo que guardó el AuthMiddleware
-		val, exists := c.Get("user_claims")
-
-		if !exists {
-			c.AbortWithStatusJSON(401, gin.H{"error": "Autenticación requerida"})
+		// La sesión pudo haber sido revocada desde /auth/sessions/revoke
+		activa, err := sesionActiva(c.Request.Context(), claims)
+		if err != nil {
+			log.Printf("Error de Redis revisando sesión: %v", err)
+			c.JSON(503, gin.H{"error": "No se pudo verificar la sesión, intente más tarde"})
+			c.Abort()
+			return
+		}
+		if !activa {
+			c.JSON(401, gin.H{"error": "Sesión revocada o expirada"})
+			c.Abort()
 			return
 		}
 
-		claims := val.(*Claims)
-
-		// Buscamos si el rol requerido está en la lista del usuario
-		hasRole := slices.Contains(claims.Roles, requiredRole)
+		// devolver los claims del usuario
+		c.Set("user_claims", claims)
 
-		if !hasRole {
-			c.AbortWithStatusJSON(403, gin.H{"error": "Autorización requerida"})
+		// Token de suplantación: solo lectura por defecto y cada petición queda en los logs
+		if claims.Act != nil {
+			peticionSuplantada(c, claims)
 			return
 		}
 
+		// El token es válido, continúa hacia la ruta solicitada
 		c.Next()
 	}
 }
@@ -112,49 +109,120 @@ func Auth(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "formato invalido de json"})
 		return
 	}
-	token, userU, err := ConnectLDAP(User.User, User.Pass, JWTManager{
+
+	if !verificarIntento(c, User.User) {
+		return
+	}
+
+	userU, err := ConnectLDAP(c.Request.Context(), User.User, User.Pass)
+	if err != nil {
+		log.Printf("ldap error: %v", err)
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrUserNotFound):
+			registrarFallo(c, User.User)
+			c.JSON(401, gin.H{"error": "Credenciales inválidas"})
+		case errors.Is(err, auth.ErrProviderUnavailable):
+			c.JSON(503, gin.H{"error": "Servicio de autenticación no disponible"})
+		default:
+			c.JSON(500, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	limpiarFallos(User.User)
+
+	// Si el usuario tiene 2FA activo, el token se entrega en /auth/login/2fa
+	estado2FA, err := leerEstadoTOTP(c.Request.Context(), User.User)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if estado2FA != nil && estado2FA.Activo {
+		desafio, err := crearDesafioMFA(c.Request.Context(), userU)
+		if err != nil {
+			log.Printf("Error de Redis: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"mfaRequired": true,
+			"challenge":   desafio,
+		})
+		return
+	}
+
+	// Sin 2FA, los grupos que lo exigen no se incluyen en el token hasta que se enrole
+	enrolamientoPendiente := politicaPermisos.requiere2FA(userU.Roles)
+	if enrolamientoPendiente {
+		userU.Roles = politicaPermisos.sinGruposCon2FA(userU.Roles)
+	}
+
+	finalizarLogin(c, userU, gin.H{"mfaEnrollmentRequired": enrolamientoPendiente})
+}
+
+// Configuración del JWT de sesión
+func jwtSesion() JWTManager {
+	return JWTManager{
 		Secret: []byte(os.Getenv("JWT_SECRET")),
 		TTL:    24 * time.Hour,
 		Issuer: "horario_estudiantes",
-	})
+	}
+}
+
+// Emite el JWT, registra el inicio de sesión y responde
+func finalizarLogin(c *gin.Context, userU *User, extra gin.H) {
+	j := jwtSesion()
+
+	sid, err := crearSesion(c, userU.Username, j.TTL, nil)
 	if err != nil {
-		log.Printf("ldap error: %v", err)
+		log.Printf("Error al registrar sesión: %v", err)
 		c.JSON(500, gin.H{"error": "Internal server error"})
 		return
 	}
-	var userID int
-	err = db.QueryRow(
-		"SELECT N_idUsuario FROM Usuarios WHERE T_codUsuario = ?",
-		User.User,
-	).Scan(&userID)
 
+	token, err := j.Generate(userU, sid)
 	if err != nil {
-		log.Println("Error obteniendo usuario para log:", err)
-		userID = 0
+		log.Printf("Error generando token: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
 	}
 
+	userID := idUsuarioPorCodigo(userU.Username)
+
 	descripcion := "Usuario inició sesión | ID: " +
 		strconv.Itoa(userID) +
-		" | Username: " + User.User
+		" | Username: " + userU.Username
+
+	evento := nuevoEvento(c, accionIniciarSesion, objetivoSesion, sid)
+	evento.UsuarioID = userID
+	evento.Actor = userU.Username
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
-	insertarLog(userID, "INICIAR_SESION", descripcion)
-	c.JSON(200, gin.H{
+	respuesta := gin.H{
 		"Token":    token,
 		"UserAuth": userU,
-	})
+	}
+	for k, v := range extra {
+		respuesta[k] = v
+	}
+	c.JSON(200, respuesta)
 }
 
-func (j JWTManager) Generate(u *User) (string, error) {
+func (j JWTManager) Generate(u *User, sessionID string) (string, error) {
 	now := time.Now()
 	claims := Claims{
 		UserID: u.Username,
 		Roles:  u.Roles,
+		MFA:    u.MFA,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    j.Issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now.Add(-clockSkewTolerance)),
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.TTL)),
 			Subject:   u.Username,
+			ID:        sessionID,
 		},
 	}
 
@@ -202,7 +270,18 @@ func (j JWTManager) validateTokenPublic(c *gin.Context) {
 
 	// Validar el token
 
-	_, err := j.Validate(tokenStr)
+	claims, err := j.Validate(tokenStr)
+	if err == nil {
+		activa, errSesion := sesionActiva(c.Request.Context(), claims)
+		if errSesion != nil {
+			log.Printf("Error de Redis revisando sesión: %v", errSesion)
+			c.JSON(503, gin.H{"status": false, "error": "No se pudo verificar la sesión"})
+			return
+		}
+		if !activa {
+			err = errors.New("sesión revocada")
+		}
+	}
 
 	if err != nil {
 		fmt.Printf("Error de validación: %v\n", err)
@@ -217,47 +296,59 @@ func (j JWTManager) validateTokenPublic(c *gin.Context) {
 	}
 }
 
-func dialLDAPS() (*ldap.Conn, error) {
-	return ldap.DialURL("ldaps://"+os.Getenv("LDAP_ADDR")+":636",
-		ldap.DialWithTLSConfig(&tls.Config{
-			InsecureSkipVerify: true,
-		}),
-	)
-}
+func ConnectLDAP(reqCtx context.Context, user string, pass string) (*User, error) {
+	var u *User
 
-func ConnectLDAP(user string, pass string, j JWTManager) (string, *User, error) {
-	l, err := dialLDAPS()
+	// La conexión sale del pool; se autentica al usuario y luego se devuelve
+	err := ldapPool.ejecutarComoUsuario(reqCtx, user, pass, func(l *conexionLDAP) error {
+		var err error
+		u, err = buscarUsuarioLDAP(l, user)
+		return err
+	})
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	defer l.Close()
 
-	l.SetTimeout(5 * time.Second)
+	return u, nil
+}
+
+// Consulta un usuario con la cuenta de servicio, sin su contraseña (p. ej. para suplantación)
+func LookupLDAPUser(reqCtx context.Context, user string) (*User, error) {
+	var u *User
 
-	err = l.Bind(user+"@upbplanner.local", pass)
+	err := ldapPool.ejecutar(reqCtx, func(l *conexionLDAP) error {
+		var err error
+		u, err = buscarUsuarioLDAP(l, user)
+		return err
+	})
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
+	return u, nil
+}
+
+// Busca la cuenta por sAMAccountName y convierte cada grupo de memberOf en un rol
+func buscarUsuarioLDAP(l *conexionLDAP, user string) (*User, error) {
 	searchRequest := ldap.NewSearchRequest(
-		"DC=upbplanner,DC=local",
+		baseDNLDAP,
 		ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases,
 		0,
 		0,
 		false,
-		fmt.Sprintf("(sAMAccountName=%s)", user),
+		fmt.Sprintf("(sAMAccountName=%s)", ldap.EscapeFilter(user)),
 		[]string{"memberOf", "displayName"},
 		nil,
 	)
 
 	sr, err := l.Search(searchRequest)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	if len(sr.Entries) == 0 {
-		return "", nil, errors.New("usuario no encontrado en LDAP")
+		return nil, auth.ErrUserNotFound
 	}
 
 	entry := sr.Entries[0]
@@ -271,17 +362,10 @@ func ConnectLDAP(user string, pass string, j JWTManager) (string, *User, error)
 		}
 	}
 
-	u := &User{
+	return &User{
 		Username: user,
 		Roles:    roles,
-	}
-
-	token, err := j.Generate(u)
-	if err != nil {
-		return "", nil, err
-	}
-
-	return token, u, nil
+	}, nil
 }
 
 func createUser(c *gin.Context) {
@@ -293,8 +377,7 @@ func createUser(c *gin.Context) {
 	}
 
 	err := CreateLDAPUser(
-		os.Getenv("ADMIN_LDAP_ADMIN"),
-		os.Getenv("ADMIN_LDAP_PASS"),
+		c.Request.Context(),
 		req.User,
 		req.Pass,
 	)
@@ -319,80 +402,71 @@ func createUser(c *gin.Context) {
 		strconv.Itoa(userID) +
 		" | Username: " + req.User
 
-	insertarLog(userID, "CREAR_USUARIO", descripcion)
+	auditar(c, userID, accionCrearUsuario, objetivoUsuario, req.User, descripcion)
 
 	c.JSON(200, gin.H{"message": "Usuario creado correctamente"})
 }
 
-func CreateLDAPUser(adminUser, adminPass, username, password string) error {
-	l, err := dialLDAPS()
-	if err != nil {
-		return err
-	}
-	defer l.Close()
-
-	err = l.Bind(adminUser+"@upbplanner.local", adminPass)
-	if err != nil {
-		return err
-	}
+func CreateLDAPUser(reqCtx context.Context, username, password string) error {
+	return ldapPool.ejecutar(reqCtx, func(l *conexionLDAP) error {
+		userDN := fmt.Sprintf("CN=%s,CN=Users,%s", username, baseDNLDAP)
 
-	userDN := fmt.Sprintf("CN=%s,CN=Users,DC=upbplanner,DC=local", username)
+		addReq := ldap.NewAddRequest(userDN, nil)
 
-	addReq := ldap.NewAddRequest(userDN, nil)
-
-	addReq.Attribute("objectClass", []string{
-		"top",
-		"person",
-		"organizationalPerson",
-		"user",
-	})
+		addReq.Attribute("objectClass", []string{
+			"top",
+			"person",
+			"organizationalPerson",
+			"user",
+		})
 
-	addReq.Attribute("cn", []string{username})
-	addReq.Attribute("sAMAccountName", []string{username})
-	addReq.Attribute("userPrincipalName", []string{username + "@upbplanner.local"})
-	addReq.Attribute("displayName", []string{username})
-	addReq.Attribute("userAccountControl", []string{"544"})
+		addReq.Attribute("cn", []string{username})
+		addReq.Attribute("sAMAccountName", []string{username})
+		addReq.Attribute("userPrincipalName", []string{username + dominioLDAP})
+		addReq.Attribute("displayName", []string{username})
+		addReq.Attribute("userAccountControl", []string{"544"})
 
-	err = l.Add(addReq)
-	if err != nil {
-		return err
-	}
+		err := l.Add(addReq)
+		if err != nil {
+			return err
+		}
 
-	quotedPwd := fmt.Sprintf("\"%s\"", password)
-	utf16Pwd := utf16.Encode([]rune(quotedPwd))
+		quotedPwd := fmt.Sprintf("\"%s\"", password)
+		utf16Pwd := utf16.Encode([]rune(quotedPwd))
 
-	pwdBytes := make([]byte, len(utf16Pwd)*2)
-	for i, v := range utf16Pwd {
-		binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
-	}
+		pwdBytes := make([]byte, len(utf16Pwd)*2)
+		for i, v := range utf16Pwd {
+			binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
+		}
 
-	modPwd := ldap.NewModifyRequest(userDN, nil)
-	modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
+		modPwd := ldap.NewModifyRequest(userDN, nil)
+		modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
 
-	err = l.Modify(modPwd)
-	if err != nil {
-		return fmt.Errorf("error seteando password: %v", err)
-	}
+		err = l.Modify(modPwd)
+		if err != nil {
+			return fmt.Errorf("error seteando password: %w", err)
+		}
 
-	modEnable := ldap.NewModifyRequest(userDN, nil)
-	modEnable.Replace("userAccountControl", []string{"512"})
+		modEnable := ldap.NewModifyRequest(userDN, nil)
+		modEnable.Replace("userAccountControl", []string{"512"})
 
-	err = l.Modify(modEnable)
-	if err != nil {
-		return fmt.Errorf("error habilitando usuario: %v", err)
-	}
+		err = l.Modify(modEnable)
+		if err != nil {
+			return fmt.Errorf("error habilitando usuario: %w", err)
+		}
 
-	groupDN := "CN=Usuarios,CN=Users,DC=upbplanner,DC=local"
+		groupDN := "CN=Usuarios,CN=Users," + baseDNLDAP
 
-	modGroup := ldap.NewModifyRequest(groupDN, nil)
-	modGroup.Add("member", []string{userDN})
+		modGroup := ldap.NewModifyRequest(groupDN, nil)
+		modGroup.Add("member", []string{userDN})
 
-	err = l.Modify(modGroup)
-	if err != nil {
-		return fmt.Errorf("error agregando al grupo Usuario: %v", err)
-	}
+		err = l.Modify(modGroup)
+		if err != nil {
+			return fmt.Errorf("error agregando al grupo Usuario: %w", err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func createAdmin(c *gin.Context) {
@@ -404,8 +478,7 @@ func createAdmin(c *gin.Context) {
 	}
 
 	err2 := CreateLDAPAdminUser(
-		os.Getenv("ADMIN_LDAP_ADMIN"),
-		os.Getenv("ADMIN_LDAP_PASS"),
+		c.Request.Context(),
 		req.User,
 		req.Pass,
 	)
@@ -420,86 +493,73 @@ func createAdmin(c *gin.Context) {
 	descripcion := fmt.Sprintf("Se creó administrador | ID: %s ",
 		req.User)
 
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(uID, "CREAR_ADMIN", descripcion)
+	evento := nuevoEvento(c, accionCrearAdmin, objetivoUsuario, req.User)
+	evento.UsuarioID = uID
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{"message": "Admin creado correctamente"})
 }
-func CreateLDAPAdminUser(adminUser, adminPass, username, password string) error {
-	l, err := dialLDAPS()
-	if err != nil {
-		return err
-	}
-	defer l.Close()
-
-	err = l.Bind(adminUser+"@upbplanner.local", adminPass)
-	if err != nil {
-		return err
-	}
-
-	userDN := fmt.Sprintf("CN=%s,CN=Users,DC=upbplanner,DC=local", username)
+func CreateLDAPAdminUser(reqCtx context.Context, username, password string) error {
+	return ldapPool.ejecutar(reqCtx, func(l *conexionLDAP) error {
+		userDN := fmt.Sprintf("CN=%s,CN=Users,%s", username, baseDNLDAP)
 
-	addReq := ldap.NewAddRequest(userDN, nil)
+		addReq := ldap.NewAddRequest(userDN, nil)
 
-	addReq.Attribute("objectClass", []string{
-		"top",
-		"person",
-		"organizationalPerson",
-		"user",
-	})
+		addReq.Attribute("objectClass", []string{
+			"top",
+			"person",
+			"organizationalPerson",
+			"user",
+		})
 
-	addReq.Attribute("cn", []string{username})
-	addReq.Attribute("sAMAccountName", []string{username})
-	addReq.Attribute("userPrincipalName", []string{username + "@upbplanner.local"})
-	addReq.Attribute("displayName", []string{username})
-	addReq.Attribute("userAccountControl", []string{"544"})
+		addReq.Attribute("cn", []string{username})
+		addReq.Attribute("sAMAccountName", []string{username})
+		addReq.Attribute("userPrincipalName", []string{username + dominioLDAP})
+		addReq.Attribute("displayName", []string{username})
+		addReq.Attribute("userAccountControl", []string{"544"})
 
-	err = l.Add(addReq)
-	if err != nil {
-		return err
-	}
+		err := l.Add(addReq)
+		if err != nil {
+			return err
+		}
 
-	quotedPwd := fmt.Sprintf("\"%s\"", password)
-	utf16Pwd := utf16.Encode([]rune(quotedPwd))
+		quotedPwd := fmt.Sprintf("\"%s\"", password)
+		utf16Pwd := utf16.Encode([]rune(quotedPwd))
 
-	pwdBytes := make([]byte, len(utf16Pwd)*2)
-	for i, v := range utf16Pwd {
-		binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
-	}
+		pwdBytes := make([]byte, len(utf16Pwd)*2)
+		for i, v := range utf16Pwd {
+			binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
+		}
 
-	modPwd := ldap.NewModifyRequest(userDN, nil)
-	modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
+		modPwd := ldap.NewModifyRequest(userDN, nil)
+		modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
 
-	err = l.Modify(modPwd)
-	if err != nil {
-		return fmt.Errorf("error seteando password: %v", err)
-	}
+		err = l.Modify(modPwd)
+		if err != nil {
+			return fmt.Errorf("error seteando password: %w", err)
+		}
 
-	modEnable := ldap.NewModifyRequest(userDN, nil)
-	modEnable.Replace("userAccountControl", []string{"512"})
+		modEnable := ldap.NewModifyRequest(userDN, nil)
+		modEnable.Replace("userAccountControl", []string{"512"})
 
-	err = l.Modify(modEnable)
-	if err != nil {
-		return fmt.Errorf("error habilitando usuario: %v", err)
-	}
+		err = l.Modify(modEnable)
+		if err != nil {
+			return fmt.Errorf("error habilitando usuario: %w", err)
+		}
 
-	groupDN := "CN=admin_upb_planner,CN=Users,DC=upbplanner,DC=local"
+		groupDN := "CN=admin_upb_planner,CN=Users," + baseDNLDAP
 
-	modGroup := ldap.NewModifyRequest(groupDN, nil)
-	modGroup.Add("member", []string{userDN})
+		modGroup := ldap.NewModifyRequest(groupDN, nil)
+		modGroup.Add("member", []string{userDN})
 
-	err = l.Modify(modGroup)
-	if err != nil {
-		return fmt.Errorf("error agregando al grupo admin_upb_planner: %v", err)
-	}
+		err = l.Modify(modGroup)
+		if err != nil {
+			return fmt.Errorf("error agregando al grupo admin_upb_planner: %w", err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func changeusrpasswd(c *gin.Context) {
@@ -509,9 +569,12 @@ func changeusrpasswd(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "JSON inválido"})
 		return
 	}
+	if !AuthorityCheck(req.User, c) {
+		c.AbortWithStatusJSON(401, gin.H{"error": "Autorización requerida"})
+		return
+	}
 	err := ChangeUserPassword(
-		os.Getenv("ADMIN_LDAP_ADMIN"),
-		os.Getenv("ADMIN_LDAP_PASS"),
+		c.Request.Context(),
 		req.User,
 		req.Pass,
 	)
@@ -519,6 +582,12 @@ func changeusrpasswd(c *gin.Context) {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	// Se cierran las demás sesiones del usuario
+	claims := c.MustGet("user_claims").(*Claims)
+	if _, err := revocarSesiones(c.Request.Context(), req.User, claims.ID); err != nil {
+		log.Printf("Error revocando sesiones: %v", err)
+	}
+
 	var userID int
 	err = db.QueryRow("SELECT N_idUsuario FROM Usuarios WHERE T_codUsuario = ?", req.User).Scan(&userID)
 
@@ -531,37 +600,28 @@ func changeusrpasswd(c *gin.Context) {
 		strconv.Itoa(userID) +
 		" | Username: " + req.User
 
-	insertarLog(userID, "CAMBIAR_CONTRASEÑA", descripcion)
+	auditar(c, userID, accionCambiarContrasena, objetivoUsuario, req.User, descripcion)
 
 	c.JSON(200, gin.H{"message": "Contraseña cambiada correctamente"})
 }
 
-func ChangeUserPassword(adminUser, adminPass, username, newPassword string) error {
-	l, err := dialLDAPS()
-	if err != nil {
-		return err
-	}
-	defer l.Close()
-
-	err = l.Bind(adminUser+"@upbplanner.local", adminPass)
-	if err != nil {
-		return err
-	}
-
-	userDN := fmt.Sprintf("CN=%s,CN=Users,DC=upbplanner,DC=local", username)
-	quotedPwd := fmt.Sprintf("\"%s\"", newPassword)
-	utf16Pwd := utf16.Encode([]rune(quotedPwd))
-	pwdBytes := make([]byte, len(utf16Pwd)*2)
-	for i, v := range utf16Pwd {
-		binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
-	}
+func ChangeUserPassword(reqCtx context.Context, username, newPassword string) error {
+	return ldapPool.ejecutar(reqCtx, func(l *conexionLDAP) error {
+		userDN := fmt.Sprintf("CN=%s,CN=Users,%s", username, baseDNLDAP)
+		quotedPwd := fmt.Sprintf("\"%s\"", newPassword)
+		utf16Pwd := utf16.Encode([]rune(quotedPwd))
+		pwdBytes := make([]byte, len(utf16Pwd)*2)
+		for i, v := range utf16Pwd {
+			binary.LittleEndian.PutUint16(pwdBytes[i*2:], v)
+		}
 
-	modPwd := ldap.NewModifyRequest(userDN, nil)
-	modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
+		modPwd := ldap.NewModifyRequest(userDN, nil)
+		modPwd.Replace("unicodePwd", []string{string(pwdBytes)})
 
-	err = l.Modify(modPwd)
-	if err != nil {
-		return fmt.Errorf("error cambiando password: %v", err)
-	}
-	return nil
+		err := l.Modify(modPwd)
+		if err != nil {
+			return fmt.Errorf("error cambiando password: %w", err)
+		}
+		return nil
+	})
 }
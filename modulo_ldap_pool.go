@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gin-quickstart/internal/auth"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+//	------------------------ POOL DE CONEXIONES LDAP ------------------------ //
+
+const (
+	dominioLDAP = "@upbplanner.local"
+	baseDNLDAP  = "DC=upbplanner,DC=local"
+)
+
+// Pool global, se crea en main() con la cuenta de servicio
+var ldapPool *poolLDAP
+
+// Conexión del pool con la marca de su último uso (para saber cuándo revisarla)
+type conexionLDAP struct {
+	*ldap.Conn
+	ultimoUso time.Time
+	descartar bool
+}
+
+type poolLDAP struct {
+	conns       chan *conexionLDAP
+	mu          sync.Mutex
+	abiertas    int
+	tamano      int
+	usuario     string
+	pass        string
+	timeoutOp   time.Duration
+	revisarCada time.Duration
+	breaker     *circuitBreaker
+}
+
+// Lee la configuración del pool desde las variables de entorno
+func nuevoPoolLDAP() *poolLDAP {
+	tamano := envInt("LDAP_POOL_SIZE", 5)
+
+	return &poolLDAP{
+		conns:       make(chan *conexionLDAP, tamano),
+		tamano:      tamano,
+		usuario:     os.Getenv("ADMIN_LDAP_ADMIN"),
+		pass:        os.Getenv("ADMIN_LDAP_PASS"),
+		timeoutOp:   envDuration("LDAP_TIMEOUT", 5*time.Second),
+		revisarCada: envDuration("LDAP_HEALTHCHECK", 30*time.Second),
+		breaker: &circuitBreaker{
+			umbral: envInt("LDAP_BREAKER_FALLOS", 5),
+			espera: envDuration("LDAP_BREAKER_ESPERA", 30*time.Second),
+		},
+	}
+}
+
+// Abre una conexión LDAPS nueva y la autentica con la cuenta de servicio
+func (p *poolLDAP) abrir() (*conexionLDAP, error) {
+	l, err := ldap.DialURL("ldaps://"+os.Getenv("LDAP_ADDR")+":636",
+		ldap.DialWithTLSDialer(&tls.Config{
+			InsecureSkipVerify: true,
+		}, &net.Dialer{Timeout: p.timeoutOp}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	l.SetTimeout(p.timeoutOp)
+
+	if err := l.Bind(p.usuario+dominioLDAP, p.pass); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return &conexionLDAP{Conn: l, ultimoUso: time.Now()}, nil
+}
+
+// Revisa que una conexión que lleva tiempo quieta siga viva
+func (p *poolLDAP) sana(cn *conexionLDAP) bool {
+	if cn.IsClosing() {
+		return false
+	}
+	if time.Since(cn.ultimoUso) < p.revisarCada {
+		return true
+	}
+	_, err := cn.WhoAmI(nil)
+	return err == nil
+}
+
+func (p *poolLDAP) cerrar(cn *conexionLDAP) {
+	cn.Close()
+	p.mu.Lock()
+	p.abiertas--
+	p.mu.Unlock()
+}
+
+// Saca una conexión del pool, o abre una nueva si todavía hay cupo
+func (p *poolLDAP) obtener(c context.Context) (*conexionLDAP, error) {
+	if !p.breaker.permitir() {
+		return nil, auth.ErrProviderUnavailable
+	}
+
+	for {
+		select {
+		case cn := <-p.conns:
+			if p.sana(cn) {
+				return cn, nil
+			}
+			p.cerrar(cn)
+			continue
+		default:
+		}
+
+		p.mu.Lock()
+		if p.abiertas < p.tamano {
+			p.abiertas++
+			p.mu.Unlock()
+
+			cn, err := p.abrir()
+			if err != nil {
+				p.mu.Lock()
+				p.abiertas--
+				p.mu.Unlock()
+				p.breaker.fallo()
+				return nil, fmt.Errorf("%w: %v", auth.ErrProviderUnavailable, err)
+			}
+			return cn, nil
+		}
+		p.mu.Unlock()
+
+		// Pool lleno: se espera a que alguien devuelva una conexión
+		select {
+		case cn := <-p.conns:
+			if p.sana(cn) {
+				return cn, nil
+			}
+			p.cerrar(cn)
+		case <-c.Done():
+			p.breaker.cancelarPrueba()
+			return nil, fmt.Errorf("%w: %v", auth.ErrProviderUnavailable, c.Err())
+		}
+	}
+}
+
+// Devuelve la conexión al pool, o la cierra si quedó inservible
+func (p *poolLDAP) devolver(cn *conexionLDAP) {
+	if cn.descartar || cn.IsClosing() {
+		p.cerrar(cn)
+		return
+	}
+	cn.ultimoUso = time.Now()
+
+	select {
+	case p.conns <- cn:
+	default:
+		p.cerrar(cn)
+	}
+}
+
+// Ejecuta una operación con una conexión del pool ya autenticada como cuenta de servicio
+func (p *poolLDAP) ejecutar(c context.Context, fn func(l *conexionLDAP) error) error {
+	c, cancel := context.WithTimeout(c, p.timeoutOp)
+	defer cancel()
+
+	cn, err := p.obtener(c)
+	if err != nil {
+		return err
+	}
+
+	err = fn(cn)
+
+	if errorDeRed(err) {
+		cn.descartar = true
+		p.breaker.fallo()
+		p.devolver(cn)
+		return fmt.Errorf("%w: %v", auth.ErrProviderUnavailable, err)
+	}
+
+	p.breaker.exito()
+	p.devolver(cn)
+	return err
+}
+
+// Igual que ejecutar, pero autenticando primero al usuario final.
+// Antes de devolver la conexión se vuelve a autenticar la cuenta de servicio.
+func (p *poolLDAP) ejecutarComoUsuario(c context.Context, user, pass string, fn func(l *conexionLDAP) error) error {
+	return p.ejecutar(c, func(l *conexionLDAP) error {
+		err := l.Bind(user+dominioLDAP, pass)
+		if err == nil {
+			err = fn(l)
+		}
+
+		if errBind := l.Bind(p.usuario+dominioLDAP, p.pass); errBind != nil {
+			log.Printf("No se pudo re-autenticar la cuenta de servicio LDAP: %v", errBind)
+			l.descartar = true
+		}
+
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return auth.ErrInvalidCredentials
+		}
+		return err
+	})
+}
+
+func errorDeRed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		ldap.IsErrorWithCode(err, ldap.ErrorNetwork) ||
+		ldap.IsErrorWithCode(err, ldap.LDAPResultTimeout) ||
+		ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) ||
+		ldap.IsErrorWithCode(err, ldap.LDAPResultBusy)
+}
+
+//	------------------------ CIRCUIT BREAKER ------------------------ //
+
+// Después de "umbral" fallos seguidos se deja de llamar al AD durante "espera".
+// Pasado ese tiempo se deja pasar una sola petición de prueba.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	umbral       int
+	espera       time.Duration
+	fallos       int
+	abiertoHasta time.Time
+	probando     bool
+}
+
+func (b *circuitBreaker) permitir() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fallos < b.umbral {
+		return true
+	}
+	if time.Now().Before(b.abiertoHasta) || b.probando {
+		return false
+	}
+	b.probando = true
+	return true
+}
+
+func (b *circuitBreaker) exito() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fallos = 0
+	b.probando = false
+}
+
+// Libera el turno de prueba sin contarlo como éxito ni como fallo
+func (b *circuitBreaker) cancelarPrueba() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probando = false
+}
+
+func (b *circuitBreaker) fallo() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fallos++
+	b.probando = false
+	if b.fallos >= b.umbral {
+		if b.fallos == b.umbral {
+			log.Printf("LDAP no disponible, circuito abierto por %v", b.espera)
+		}
+		b.abiertoHasta = time.Now().Add(b.espera)
+	}
+}
+
+//	------------------------ CONFIGURACIÓN ------------------------ //
+
+func envInt(nombre string, porDefecto int) int {
+	v, err := strconv.Atoi(os.Getenv(nombre))
+	if err != nil || v <= 0 {
+		return porDefecto
+	}
+	return v
+}
+
+func envDuration(nombre string, porDefecto time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(nombre))
+	if err != nil || v <= 0 {
+		return porDefecto
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ BLOQUEO POR INTENTOS FALLIDOS ------------------------ //
+
+type configBloqueo struct {
+	maxUsuario  int
+	maxIP       int
+	ventana     time.Duration
+	bloqueo     time.Duration
+	retrasoBase time.Duration
+	retrasoMax  time.Duration
+}
+
+var bloqueoCfg configBloqueo
+
+func leerConfigBloqueo() configBloqueo {
+	return configBloqueo{
+		maxUsuario:  envInt("LOGIN_MAX_ATTEMPTS", 5),
+		maxIP:       envInt("LOGIN_MAX_ATTEMPTS_IP", 20),
+		ventana:     envDuration("LOGIN_ATTEMPTS_WINDOW", 15*time.Minute),
+		bloqueo:     envDuration("LOGIN_LOCKOUT", 15*time.Minute),
+		retrasoBase: envDuration("LOGIN_DELAY_BASE", 1*time.Second),
+		retrasoMax:  envDuration("LOGIN_DELAY_MAX", 30*time.Second),
+	}
+}
+
+// El sAMAccountName no distingue mayúsculas: "Juan" y "JUAN" comparten contador y bloqueo
+func normalizarUsuario(usuario string) string {
+	return strings.ToLower(strings.TrimSpace(usuario))
+}
+
+// Revisa bloqueos y retrasos vigentes. Si el intento no se permite, responde 429 y devuelve false.
+func verificarIntento(c *gin.Context, usuario string) bool {
+	usuario = normalizarUsuario(usuario)
+	claves := []string{
+		"lockout:user:" + usuario,
+		"lockout:ip:" + c.ClientIP(),
+		"loginwait:user:" + usuario,
+	}
+
+	var espera time.Duration
+	for _, clave := range claves {
+		ttl, err := rdb.TTL(c.Request.Context(), clave).Result()
+		if err != nil {
+			// Si Redis no responde no se bloquea el inicio de sesión
+			log.Printf("Error de Redis revisando bloqueo: %v", err)
+			return true
+		}
+		if ttl > espera {
+			espera = ttl
+		}
+	}
+
+	if espera <= 0 {
+		return true
+	}
+
+	segundos := int(math.Ceil(espera.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(segundos))
+	c.AbortWithStatusJSON(429, gin.H{
+		"error":        "Demasiados intentos fallidos, intente más tarde",
+		"reintentarEn": segundos,
+	})
+	return false
+}
+
+// Suma un intento fallido para el usuario y para la IP, y aplica retraso o bloqueo según corresponda
+func registrarFallo(c *gin.Context, usuario string) {
+	usuario = normalizarUsuario(usuario)
+	ip := c.ClientIP()
+	cfg := bloqueoCfg
+
+	fallosUsuario, err := incrementarEnVentana(c.Request.Context(), "loginfail:user:"+usuario, cfg.ventana)
+	if err != nil {
+		log.Printf("Error de Redis registrando intento fallido: %v", err)
+		return
+	}
+
+	fallosIP, err := incrementarEnVentana(c.Request.Context(), "loginfail:ip:"+ip, cfg.ventana)
+	if err != nil {
+		log.Printf("Error de Redis registrando intento fallido: %v", err)
+		return
+	}
+
+	if fallosUsuario >= int64(cfg.maxUsuario) {
+		rdb.Set(ctx, "lockout:user:"+usuario, ip, cfg.bloqueo)
+		rdb.Del(ctx, "loginfail:user:"+usuario, "loginwait:user:"+usuario)
+
+		descripcion := fmt.Sprintf("Cuenta bloqueada por intentos fallidos | Username: %s | IP: %s | Intentos: %d | Duración: %v",
+			usuario, ip, fallosUsuario, cfg.bloqueo)
+		auditar(c, idUsuarioPorCodigo(usuario), accionBloqueoCuenta, objetivoUsuario, usuario, descripcion)
+	} else if fallosUsuario > 1 {
+		// Retraso progresivo: base, 2*base, 4*base... hasta el máximo
+		retraso := cfg.retrasoBase << (fallosUsuario - 2)
+		if retraso > cfg.retrasoMax || retraso <= 0 {
+			retraso = cfg.retrasoMax
+		}
+		rdb.Set(ctx, "loginwait:user:"+usuario, 1, retraso)
+	}
+
+	if fallosIP >= int64(cfg.maxIP) {
+		rdb.Set(ctx, "lockout:ip:"+ip, usuario, cfg.bloqueo)
+		rdb.Del(ctx, "loginfail:ip:"+ip)
+
+		descripcion := fmt.Sprintf("IP bloqueada por intentos fallidos | IP: %s | Último username: %s | Intentos: %d | Duración: %v",
+			ip, usuario, fallosIP, cfg.bloqueo)
+		auditar(c, 0, accionBloqueoIP, objetivoIP, ip, descripcion)
+	}
+}
+
+// Un inicio de sesión exitoso reinicia el contador del usuario
+func limpiarFallos(usuario string) {
+	usuario = normalizarUsuario(usuario)
+	if err := rdb.Del(ctx, "loginfail:user:"+usuario, "loginwait:user:"+usuario).Err(); err != nil {
+		log.Printf("Error de Redis limpiando intentos fallidos: %v", err)
+	}
+}
+
+func incrementarEnVentana(c context.Context, clave string, ventana time.Duration) (int64, error) {
+	pipe := rdb.TxPipeline()
+	n := pipe.Incr(c, clave)
+	pipe.ExpireNX(c, clave, ventana)
+
+	if _, err := pipe.Exec(c); err != nil {
+		return 0, err
+	}
+	return n.Val(), nil
+}
+
+// Desbloqueo manual por parte de un administrador
+func unlockAccount(c *gin.Context) {
+	var req UnlockAccount
+
+	err := c.ShouldBindJSON(&req)
+	req.User = normalizarUsuario(req.User)
+	if err != nil || (req.User == "" && req.IP == "") {
+		c.JSON(400, gin.H{"error": "Se requiere user o ip"})
+		return
+	}
+
+	var claves []string
+	if req.User != "" {
+		claves = append(claves, "lockout:user:"+req.User, "loginfail:user:"+req.User, "loginwait:user:"+req.User)
+	}
+	if req.IP != "" {
+		claves = append(claves, "lockout:ip:"+req.IP, "loginfail:ip:"+req.IP)
+	}
+
+	if err := rdb.Del(c.Request.Context(), claves...).Err(); err != nil {
+		log.Printf("Error al desbloquear en Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Error interno al desbloquear"})
+		return
+	}
+
+	// Log
+	admin := c.MustGet("user_claims").(*Claims)
+	descripcion := fmt.Sprintf("Desbloqueo manual | Username: %s | IP: %s | Admin: %s",
+		req.User, req.IP, admin.UserID)
+
+	auditar(c, idUsuarioPorCodigo(admin.UserID), accionDesbloqueoCuenta, objetivoUsuario, req.User, descripcion)
+
+	c.JSON(200, gin.H{"message": "Desbloqueo realizado correctamente"})
+}
@@ -1,57 +1,25 @@
 package main
 
 import (
-	"log"
-
 	"github.com/gin-gonic/gin"
 )
 
+// Registro sin contexto de petición; los handlers usan nuevoEvento + registrarEvento
 func insertarLog(usuarioID int, accion string, descripcion string) {
-	var query string
-	var args []interface{}
-
-	if usuarioID == 0 {
-
-		query = `
-		INSERT INTO Logs (T_accion, T_Descripcion, Dt_fecha)
-		VALUES (?, ?, NOW())
-		`
-		args = []interface{}{accion, descripcion}
-	} else {
-
-		query = `
-		INSERT INTO Logs (N_idUsuario, T_accion, T_Descripcion, Dt_fecha)
-		VALUES (?, ?, ?, NOW())
-		`
-		args = []interface{}{usuarioID, accion, descripcion}
-	}
-
-	_, err := db.Exec(query, args...)
-	if err != nil {
-		log.Println("Error al insertar log:", err)
-	}
+	registrarEvento(EventoAuditoria{
+		UsuarioID:   usuarioID,
+		Accion:      AccionAuditoria(accion),
+		Descripcion: descripcion,
+	})
 }
 
+// El id del usuario lo resuelve el escritor de auditoría con la caché de ids
 func insertLogCod(codUsuario string, accion string, descripcion string) {
-	var usuarioID int
-
-	err := db.QueryRow("CALL get_id_tabla(?)", codUsuario).Scan(&usuarioID)
-
-	if err != nil {
-		log.Printf("Error al obtener ID para el usuario %s: %v", codUsuario, err)
-		return
-	}
-
-	query := `
-        INSERT INTO Logs (N_idUsuario, T_accion, T_Descripcion, Dt_fecha)
-        VALUES (?, ?, ?, NOW())
-    `
-	args := []interface{}{usuarioID, accion, descripcion}
-
-	_, err = db.Exec(query, args...)
-	if err != nil {
-		log.Println("Error al insertar log final:", err)
-	}
+	registrarEvento(EventoAuditoria{
+		CodUsuario:  codUsuario,
+		Accion:      AccionAuditoria(accion),
+		Descripcion: descripcion,
+	})
 }
 
 func insertLog(c *gin.Context) {
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,7 +25,7 @@ func GetNotificaciones(c *gin.Context) {
 		err := json.Unmarshal([]byte(val), &notiArray)
 
 		if err == nil {
-			c.JSON(200, notiArray)
+			c.JSON(200, conZonaNotificaciones(notiArray, zonaUsuario(id_user)))
 			return
 
 		}
@@ -78,7 +80,15 @@ func GetNotificaciones(c *gin.Context) {
 	}
 
 	// Devuelve la consulta de la base relacional
-	c.JSON(200, notiArray)
+	c.JSON(200, conZonaNotificaciones(notiArray, zonaUsuario(id_user)))
+}
+
+// Agrega la fecha de emisión en RFC 3339 en la zona del usuario
+func conZonaNotificaciones(notiArray []Notificacion, zona *time.Location) []Notificacion {
+	for i := range notiArray {
+		notiArray[i].Emision = rfc3339BD(notiArray[i].Dt_fechaEmision, zona)
+	}
+	return notiArray
 }
 
 func addNotificacion(c *gin.Context) {
@@ -111,6 +121,17 @@ func addNotificacion(c *gin.Context) {
 
 	fmt.Printf("%#v\n", notiNewValue)
 
+	// Sin desfase la fecha se toma en la zona del usuario; vacía es ahora
+	zona := zonaInstitucion
+	if notiNewValue.CodUsuario != nil {
+		zona = zonaUsuario(*notiNewValue.CodUsuario)
+	}
+	notiNewValue.Dt_fechaEmision, err = fechaEmisionBD(notiNewValue.Dt_fechaEmision, zona)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "fechaEmision debe ser RFC 3339 o YYYY-MM-DD HH:MM:SS"})
+		return
+	}
+
 	//	Aquí se hace el llamado al Procedimiento
 	result, err := db.Exec("INSERT INTO Notificaciones (T_nombre, T_descripcion, Dt_fechaEmision, N_idToDoList)  VALUES (?, ?, ?, ?)",
 		notiNewValue.T_nombre,
@@ -143,11 +164,11 @@ func addNotificacion(c *gin.Context) {
 		" | Usuario ID: " + strconv.Itoa(notiNewValue.N_idUsuario) +
 		" | Nombre: " + notiNewValue.T_nombre
 
-	insertarLog(
-		notiNewValue.N_idUsuario,
-		"CREAR_NOTIFICACION",
-		descripcion,
-	)
+	evento := nuevoEvento(c, accionCrearNotificacion, objetivoNotificacion, strconv.FormatInt(insertedID, 10))
+	evento.UsuarioID = notiNewValue.N_idUsuario
+	evento.Despues = notiNewValue
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{
 		"message": "Notificación creada correctamente",
@@ -207,14 +228,10 @@ func deleteNotifications(c *gin.Context) {
 	descripcion := fmt.Sprintf("Se eliminaron los recordatorios | IDs: %s | Usuario ID: %d",
 		idsNotifications.Ids, userId)
 
-	go func(uID string, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertLogCod(uID, acc, desc)
-	}(*idsNotifications.CodUsuario, "ELIMINAR_NOTIFICACIONES", descripcion)
+	evento := nuevoEvento(c, accionEliminarNotificaciones, objetivoNotificacion, idsNotifications.Ids)
+	evento.UsuarioID = userId
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{
 		"message": "Notificaciones eliminadas correctamente",
@@ -287,11 +304,11 @@ func muteNotification(c *gin.Context) {
 
 	fmt.Println(descripcion)
 
-	insertarLog(
-		notiNewValue.P_idUsuario,
-		"CONFIGURAR_NOTIFICACIONES",
-		descripcion,
-	)
+	evento := nuevoEvento(c, accionConfigurarNotificaciones, objetivoUsuario, strconv.Itoa(notiNewValue.P_idUsuario))
+	evento.UsuarioID = notiNewValue.P_idUsuario
+	evento.Despues = notiNewValue
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	if rowsAffected == 0 {
 		c.JSON(200, gin.H{"message": "No hubo cambios"})
@@ -304,6 +321,25 @@ func muteNotification(c *gin.Context) {
 
 }
 
+// Fecha de emisión para Notificaciones y Correos
+func fechaEmisionBD(valor string, zona *time.Location) (string, error) {
+	if valor == "" {
+		return fechaHoraBD(time.Now()), nil
+	}
+	return fechaClienteBD(valor, zona)
+}
+
+// Deja un correo en la cola (tabla Correos) dirigido directamente a un usuario
+func encolarCorreo(idUsuario int, asunto, contenido string) error {
+	_, err := db.Exec("INSERT INTO Correos (T_asunto, T_contenido, Dt_fechaEmision, N_idUsuario) VALUES (?, ?, ?, ?)",
+		asunto,
+		contenido,
+		fechaHoraBD(time.Now()),
+		idUsuario,
+	)
+	return err
+}
+
 func addCorreo(c *gin.Context) {
 	var correoNewValue NewCorreo
 
@@ -315,6 +351,13 @@ func addCorreo(c *gin.Context) {
 		return
 	}
 
+	// Sin desfase la fecha se toma en la zona de la institución; vacía es ahora
+	correoNewValue.Dt_fechaEmision, err = fechaEmisionBD(correoNewValue.Dt_fechaEmision, zonaInstitucion)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "fechaEmision debe ser RFC 3339 o YYYY-MM-DD HH:MM:SS"})
+		return
+	}
+
 	//	Aquí se hace el llamado al Procedimiento
 	result, err := db.Exec("INSERT INTO Correos (T_asunto, T_contenido, Dt_fechaEmision, N_idToDoList) VALUES (?, ?, ?, ?)",
 		correoNewValue.T_asunto,
@@ -343,11 +386,11 @@ func addCorreo(c *gin.Context) {
 		" | Usuario ID: " + strconv.Itoa(correoNewValue.N_idUsuario) +
 		" | Asunto: " + correoNewValue.T_asunto
 
-	insertarLog(
-		correoNewValue.N_idUsuario,
-		"CREAR_CORREO",
-		descripcion,
-	)
+	evento := nuevoEvento(c, accionCrearCorreo, objetivoCorreo, strconv.FormatInt(insertedID, 10))
+	evento.UsuarioID = correoNewValue.N_idUsuario
+	evento.Despues = correoNewValue
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{
 		"message": "Correo creado correctamente",
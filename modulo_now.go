@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ AHORA Y SIGUIENTE ------------------------ //
+
+// Días hacia adelante en los que se busca la siguiente clase o actividad
+const horizonteSiguiente = 14
+
+type EventoAhora struct {
+	EventoCalendario
+	MinutosRestantes   *int `json:"minutosRestantes,omitempty"`
+	MinutosParaEmpezar *int `json:"minutosParaEmpezar,omitempty"`
+}
+
+// Clase o actividad en curso y la siguiente, para el widget de inicio
+func getNowAndNext(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	datos, err := consultarCalendario(claims.UserID, incluirCalendario{oficial: true, personal: true})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	ahora := time.Now().In(zonaInstitucion)
+	actual, siguiente := ahoraYSiguiente(datos, ahora)
+
+	zona := zonaUsuario(claims.UserID)
+	for _, e := range []*EventoAhora{actual, siguiente} {
+		if e != nil {
+			e.enZona(zona)
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"at":                  ahora.In(zona).Format(time.RFC3339),
+		"timezone":            zona.String(),
+		"institutionTimezone": zonaInstitucion.String(),
+		"now":                 actual,
+		"next":                siguiente,
+	})
+}
+
+// Si hay varias en curso se toma la que empezó primero; la siguiente es la
+// primera que empieza después de ahora
+func ahoraYSiguiente(datos datosCalendario, ahora time.Time) (*EventoAhora, *EventoAhora) {
+	hoy := time.Date(ahora.Year(), ahora.Month(), ahora.Day(), 0, 0, 0, 0, zonaInstitucion)
+
+	var actual, siguiente *EventoAhora
+	for _, e := range datos.expandir(hoy, hoy.AddDate(0, 0, horizonteSiguiente)) {
+		switch {
+		case actual == nil && !e.orden.After(ahora) && e.termina.After(ahora):
+			minutos := minutosHasta(ahora, e.termina)
+			actual = &EventoAhora{EventoCalendario: e, MinutosRestantes: &minutos}
+		case e.orden.After(ahora):
+			minutos := minutosHasta(ahora, e.orden)
+			siguiente = &EventoAhora{EventoCalendario: e, MinutosParaEmpezar: &minutos}
+		}
+		if siguiente != nil {
+			break
+		}
+	}
+	return actual, siguiente
+}
+
+// Redondeado hacia arriba: faltando 30 segundos todavía queda 1 minuto
+func minutosHasta(desde, hasta time.Time) int {
+	return int(math.Ceil(hasta.Sub(desde).Minutes()))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -128,6 +130,49 @@ func getOfficialScheduleByUserId(c *gin.Context) {
 	c.JSON(200, ofcschedules)
 }
 
+// Horario oficial del usuario, sin pasar por la caché de Redis
+func consultarHorarioOficial(codUsuario string) ([]OfficialSchedule, error) {
+	rows, err := db.Query(`SELECT ao.* FROM ActividadesOficiales ao JOIN Usuarios u ON ao.N_idUsuario = u.N_idUsuario WHERE u.T_codUsuario = ?`, codUsuario)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ofcschedules []OfficialSchedule
+	for rows.Next() {
+		var ofcschedule OfficialSchedule
+		if err := rows.Scan(camposClaseOficial(&ofcschedule)...); err != nil {
+			return nil, err
+		}
+		ofcschedules = append(ofcschedules, ofcschedule)
+	}
+	return ofcschedules, rows.Err()
+}
+
+// Destinos de Scan para las columnas de ActividadesOficiales (ao.*), en orden
+func camposClaseOficial(o *OfficialSchedule) []any {
+	return []any{
+		&o.N_idHorario,
+		&o.N_iduser,
+		&o.N_idcourse,
+		&o.Nrc,
+		&o.Course,
+		&o.Tag,
+		&o.Teacher,
+		&o.Day,
+		&o.StartHour,
+		&o.EndHour,
+		&o.Classroom,
+		&o.Credits,
+		&o.Standardofcalification,
+		&o.Campus,
+		&o.N_idPeriodoAcademico,
+		&o.Periodo_academico,
+		&o.FechaInicio,
+		&o.FechaFinal,
+	}
+}
+
 func getActivitiesTimesData(c *gin.Context) {
 	var checkActTime CheckActivitiesTimesData
 
@@ -326,7 +371,12 @@ func addAcademicPeriod(c *gin.Context) {
 		" | Fecha final: " + newAcademicPeriodValue.Dt_fechaFinal +
 		" | Usuario: " + strconv.Itoa(newAcademicPeriodValue.N_idUsuario)
 
-	insertarLog(newAcademicPeriodValue.N_idUsuario, "AGREGAR PERIODO ACADEMICO", descripcion)
+	evento := nuevoEvento(c, accionAgregarPeriodoAcademico, objetivoPeriodo, "")
+	evento.UsuarioID = newAcademicPeriodValue.N_idUsuario
+	evento.Despues = newAcademicPeriodValue
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
+
 	c.JSON(200, gin.H{
 		"message": "Periodo académico añadido correctamente",
 	})
@@ -358,6 +408,8 @@ func updateAcademicPeriod(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaPeriodo(newAcademicPeriodValue.N_idPeriodo)
+
 	// Aquí se hace el llamado al Procedimiento
 	result, err := db.Exec("CALL editarPeriodo(?, ?, ?, ?);",
 		newAcademicPeriodValue.N_idPeriodo,
@@ -407,7 +459,13 @@ func updateAcademicPeriod(c *gin.Context) {
 		" | Fecha final: " + fechaFin +
 		" | Usuario: " + strconv.Itoa(newAcademicPeriodValue.N_idUsuario)
 
-	insertarLog(newAcademicPeriodValue.N_idUsuario, "EDITAR PERIODO ACADEMICO", descripcion)
+	evento := nuevoEvento(c, accionEditarPeriodoAcademico, objetivoPeriodo, strconv.Itoa(newAcademicPeriodValue.N_idPeriodo))
+	evento.UsuarioID = newAcademicPeriodValue.N_idUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaPeriodo(newAcademicPeriodValue.N_idPeriodo)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
+
 	c.JSON(200, gin.H{
 		"message": "Periodo academico editado correctamente",
 	})
@@ -439,6 +497,8 @@ func deleteAcademicPeriod(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaPeriodo(newAcademicPeriodValue.N_idPeriodo)
+
 	result, err := db.Exec("CALL eliminarPeriodo(?);",
 		newAcademicPeriodValue.N_idPeriodo,
 	)
@@ -461,9 +521,44 @@ func deleteAcademicPeriod(c *gin.Context) {
 	descripcion := "Se eliminó un periodo académico: " +
 		" | ID: " + strconv.Itoa(newAcademicPeriodValue.N_idUsuario)
 
-	insertarLog(newAcademicPeriodValue.N_idUsuario, "ELIMINAR PERIODO ACADEMICO", descripcion)
+	evento := nuevoEvento(c, accionEliminarPeriodoAcademico, objetivoPeriodo, strconv.Itoa(newAcademicPeriodValue.N_idPeriodo))
+	evento.UsuarioID = newAcademicPeriodValue.N_idUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaPeriodo(newAcademicPeriodValue.N_idPeriodo)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
+
 	c.JSON(200, gin.H{
 		"message": "Periodo academico borrado correctamente",
 	})
 
 }
+
+// Estado de un período académico para las instantáneas de auditoría; nil si no se pudo leer
+func instantaneaPeriodo(idPeriodo int) *AcademicPeriod {
+	periodo, err := consultarPeriodo(idPeriodo)
+	if err != nil {
+		log.Printf("Error leyendo período académico para auditoría: %v", err)
+	}
+	return periodo
+}
+
+// Un período académico; nil sin error si no existe
+func consultarPeriodo(idPeriodo int) (*AcademicPeriod, error) {
+	var periodo AcademicPeriod
+
+	err := db.QueryRow(`SELECT * FROM PeriodoAcademico WHERE N_idPeriodoAcademico = ?`, idPeriodo).Scan(
+		&periodo.N_idPeriodoAcademico,
+		&periodo.T_nombre,
+		&periodo.Dt_fechaInicio,
+		&periodo.Dt_fechaFinal,
+		&periodo.B_isDeleted,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &periodo, nil
+}
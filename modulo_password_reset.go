@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin-quickstart/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ RESTABLECER CONTRASEÑA ------------------------ //
+
+const duracionTokenReset = 15 * time.Minute
+
+// En Redis solo se guarda "<sha256 del token>|<expiración unix>", nunca el token
+func hashTokenReset(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
+
+// Genera el token, guarda su hash y envía el correo por la cola de Correos
+func requestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.User == "" {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+
+	// La respuesta es la misma exista o no el usuario, para no revelar cuentas;
+	// por eso los errores internos también la devuelven
+	respuesta := gin.H{"message": "Si el usuario existe, se envió un correo con las instrucciones"}
+
+	// Se cuenta antes de buscar el usuario, así el límite no revela si existe
+	ventanaReset := envDuration("RESET_WINDOW", time.Hour)
+	porUsuario, err := incrementarEnVentana(c.Request.Context(), "resetreq:user:"+normalizarUsuario(req.User), ventanaReset)
+	if err == nil {
+		var porIP int64
+		porIP, err = incrementarEnVentana(c.Request.Context(), "resetreq:ip:"+c.ClientIP(), ventanaReset)
+		if err == nil && (porUsuario > int64(envInt("RESET_MAX_PER_USER", 3)) || porIP > int64(envInt("RESET_MAX_PER_IP", 10))) {
+			c.JSON(429, gin.H{"error": "Demasiadas solicitudes, intente más tarde"})
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Error de Redis contando solicitudes de restablecimiento: %v", err)
+		c.JSON(200, respuesta)
+		return
+	}
+
+	userID := idUsuarioPorCodigo(req.User)
+	if userID == 0 {
+		c.JSON(200, respuesta)
+		return
+	}
+
+	bytesToken := make([]byte, 32)
+	if _, err := rand.Read(bytesToken); err != nil {
+		log.Printf("Error generando token: %v", err)
+		c.JSON(200, respuesta)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytesToken)
+
+	expira := time.Now().Add(duracionTokenReset)
+	valor := hashTokenReset(token) + "|" + strconv.FormatInt(expira.Unix(), 10)
+
+	// Un token nuevo reemplaza al anterior
+	if err := rdb.Set(c.Request.Context(), "reset:"+req.User, valor, duracionTokenReset).Err(); err != nil {
+		log.Printf("Error al guardar en Redis: %v", err)
+		c.JSON(200, respuesta)
+		return
+	}
+
+	contenido := fmt.Sprintf("Tu código para restablecer la contraseña es: %s\nExpira en %d minutos.",
+		token, int(duracionTokenReset.Minutes()))
+	if url := os.Getenv("RESET_PASSWORD_URL"); url != "" {
+		contenido += "\nTambién puedes usar este enlace: " + url + token
+	}
+
+	if err := encolarCorreo(userID, "Restablecer contraseña", contenido); err != nil {
+		log.Printf("Database error: %v", err)
+		rdb.Del(ctx, "reset:"+req.User)
+		c.JSON(200, respuesta)
+		return
+	}
+
+	descripcion := fmt.Sprintf("Se solicitó restablecer contraseña | Usuario ID: %d | Username: %s", userID, req.User)
+	auditar(c, userID, accionSolicitarRestablecer, objetivoUsuario, req.User, descripcion)
+
+	c.JSON(200, respuesta)
+}
+
+// Valida y consume el token, y cambia la contraseña en el AD.
+// Si el cambio falla, el token se restaura para poder reintentar.
+func confirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirm
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.User == "" || req.Token == "" || req.NewPass == "" {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+
+	if !verificarIntento(c, req.User) {
+		return
+	}
+
+	clave := "reset:" + req.User
+
+	// GETDEL: solo una petición puede tomar el token
+	val, err := rdb.GetDel(c.Request.Context(), clave).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Error de Redis: %v", err)
+		}
+		registrarFallo(c, req.User)
+		c.JSON(401, gin.H{"error": "Token inválido o expirado"})
+		return
+	}
+
+	hash, expiraTxt, _ := strings.Cut(val, "|")
+	expiraUnix, _ := strconv.ParseInt(expiraTxt, 10, 64)
+	restante := time.Until(time.Unix(expiraUnix, 0))
+
+	restaurar := func() {
+		if restante > 0 {
+			// SetNX para no pisar un token más nuevo que se haya pedido mientras tanto
+			rdb.SetNX(ctx, clave, val, restante)
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashTokenReset(req.Token))) != 1 {
+		restaurar()
+		registrarFallo(c, req.User)
+		c.JSON(401, gin.H{"error": "Token inválido o expirado"})
+		return
+	}
+
+	err = ChangeUserPassword(c.Request.Context(), req.User, req.NewPass)
+	if err != nil {
+		restaurar()
+		log.Printf("ldap error: %v", err)
+		if errors.Is(err, auth.ErrProviderUnavailable) {
+			c.JSON(503, gin.H{"error": "Servicio de autenticación no disponible"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "No se pudo cambiar la contraseña"})
+		return
+	}
+
+	limpiarFallos(req.User)
+
+	// Quien tenía la contraseña anterior no debe seguir con sesiones abiertas
+	if _, err := revocarSesiones(c.Request.Context(), req.User, ""); err != nil {
+		log.Printf("Error revocando sesiones: %v", err)
+	}
+
+	userID := idUsuarioPorCodigo(req.User)
+	descripcion := "Se restableció contraseña con token | ID: " +
+		strconv.Itoa(userID) +
+		" | Username: " + req.User
+
+	auditar(c, userID, accionCambiarContrasena, objetivoUsuario, req.User, descripcion)
+
+	c.JSON(200, gin.H{"message": "Contraseña cambiada correctamente"})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	------------------------ PERMISOS POR GRUPO ------------------------ //
+
+// Permisos con nombre que usan las rutas
+const (
+	permisoPeriodosEscribir  = "periods:write"
+	permisoImportarHorario   = "import:run"
+	permisoGestionarUsuarios = "users:manage"
+	permisoLeerAuditoria     = "audit:read"
+	permisoSuplantar         = "users:impersonate"
+)
+
+// Lista de todos los permisos; "*" en la política equivale a todos ellos
+var permisosConocidos = []string{
+	permisoPeriodosEscribir,
+	permisoImportarHorario,
+	permisoGestionarUsuarios,
+	permisoLeerAuditoria,
+	permisoSuplantar,
+}
+
+// Política por defecto, incluida en el binario (la imagen de Docker solo copia el ejecutable)
+//
+//go:embed config/permissions.json
+var politicaPorDefecto []byte
+
+// Relación grupo del directorio -> permisos de la aplicación
+type PoliticaPermisos struct {
+	Grupos      map[string][]string `json:"grupos"`
+	Requiere2FA []string            `json:"requiere2FA"`
+}
+
+var politicaPermisos *PoliticaPermisos
+
+// Carga la política desde PERMISSIONS_FILE, o la embebida si no se configuró
+func cargarPoliticaPermisos() *PoliticaPermisos {
+	data := politicaPorDefecto
+
+	if ruta := os.Getenv("PERMISSIONS_FILE"); ruta != "" {
+		contenido, err := os.ReadFile(ruta)
+		if err != nil {
+			log.Fatalf("No se pudo leer la política de permisos %s: %v", ruta, err)
+		}
+		data = contenido
+	}
+
+	var politica PoliticaPermisos
+	if err := json.Unmarshal(data, &politica); err != nil {
+		log.Fatalf("Política de permisos inválida: %v", err)
+	}
+
+	for grupo, permisos := range politica.Grupos {
+		for _, permiso := range permisos {
+			if permiso != "*" && !slices.Contains(permisosConocidos, permiso) {
+				log.Printf("Permiso desconocido %q en el grupo %s", permiso, grupo)
+			}
+		}
+	}
+
+	return &politica
+}
+
+// Devuelve los permisos efectivos (sin repetir y ordenados) de una lista de grupos
+func (p *PoliticaPermisos) permisosDe(roles []string) []string {
+	var permisos []string
+
+	for _, rol := range roles {
+		for _, permiso := range p.Grupos[rol] {
+			if permiso == "*" {
+				permisos = append(permisos, permisosConocidos...)
+			} else {
+				permisos = append(permisos, permiso)
+			}
+		}
+	}
+
+	slices.Sort(permisos)
+	return slices.Compact(permisos)
+}
+
+// Indica si alguno de los grupos exige segundo factor
+func (p *PoliticaPermisos) requiere2FA(roles []string) bool {
+	for _, rol := range roles {
+		if slices.Contains(p.Requiere2FA, rol) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quita los grupos que exigen segundo factor
+func (p *PoliticaPermisos) sinGruposCon2FA(roles []string) []string {
+	return slices.DeleteFunc(slices.Clone(roles), func(rol string) bool {
+		return slices.Contains(p.Requiere2FA, rol)
+	})
+}
+
+// Verifica que alguno de los grupos del usuario otorgue el permiso pedido
+func PermissionMiddleware(permiso string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, exists := c.Get("user_claims")
+
+		if !exists {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Autenticación requerida"})
+			return
+		}
+
+		claims := val.(*Claims)
+
+		// Los permisos no van en el token: se calculan en cada petición con la política cargada
+		// al arrancar, así que un cambio aplica al reiniciar el servicio sin volver a iniciar sesión
+		if !slices.Contains(politicaPermisos.permisosDe(claims.Roles), permiso) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Autorización requerida"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Permisos efectivos del usuario autenticado
+func getMyPermissions(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	permisos := politicaPermisos.permisosDe(claims.Roles)
+	if permisos == nil {
+		permisos = []string{}
+	}
+
+	c.JSON(200, gin.H{
+		"userId":   claims.UserID,
+		"roles":    claims.Roles,
+		"permisos": permisos,
+	})
+}
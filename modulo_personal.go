@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"github.com/gin-gonic/gin"
 )
 
@@ -102,6 +103,18 @@ func updatePersonalScheduleByIdCourse(c *gin.Context) {
 		return
 	}
 
+	bloque, err := nuevoBloque(bloquePersonal, personalNewValue.P_idCurso, personalNewValue.P_nombreCurso,
+		personalNewValue.P_dia, personalNewValue.P_horaInicio, personalNewValue.P_horaFin,
+		&personalNewValue.P_fechaInicio, &personalNewValue.P_fechaFin)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Horario inválido: " + err.Error()})
+		return
+	}
+	conflictos, seguir := verificarConflictos(c, *personalNewValue.CodUsuario, bloque, personalNewValue.AllowConflicts)
+	if !seguir {
+		return
+	}
+
 	/*
 		type EditPersonalActivity struct {
 			P_idCurso     int    `json:"P_idCurso"`
@@ -136,6 +149,8 @@ func updatePersonalScheduleByIdCourse(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaActividadPersonal(*personalNewValue.CodUsuario, personalNewValue.P_idCurso)
+
 	//	Aquí se hace el llamado al Procedimiento
 	result, err := db.Exec("CALL editar_actividad_personal(?, ?, ?, ?, ?, ?, ?, ?)",
 		personalNewValue.P_idCurso,
@@ -164,6 +179,8 @@ func updatePersonalScheduleByIdCourse(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*personalNewValue.CodUsuario)
+
 	// Log
 	var userId int
 	err4 := db.QueryRow("CALL get_id_tabla(?)", *personalNewValue.CodUsuario).Scan(&userId)
@@ -174,18 +191,20 @@ func updatePersonalScheduleByIdCourse(c *gin.Context) {
 	descripcion := fmt.Sprintf("Se actualizó actividad personal | ID: %d | Usuario ID: %d",
 		personalNewValue.P_idCurso, userId)
 
-	go func(uID string, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertLogCod(uID, acc, desc)
-	}(*personalNewValue.CodUsuario, "ACTUALIZAR_ACTIVIDAD_PERSONAL", descripcion)
+	evento := nuevoEvento(c, accionActualizarActividad, objetivoActividad, strconv.Itoa(personalNewValue.P_idCurso))
+	evento.UsuarioID = userId
+	evento.Antes = antes
+	evento.Despues = instantaneaActividadPersonal(*personalNewValue.CodUsuario, personalNewValue.P_idCurso)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
-	c.JSON(200, gin.H{
+	respuesta := gin.H{
 		"message": "Actividad actualizada correctamente",
-	})
+	}
+	if len(conflictos) > 0 {
+		respuesta["warnings"] = conflictos
+	}
+	c.JSON(200, respuesta)
 }
 
 func deleteOrRecoveryPersonalScheduleByIdCourse(c *gin.Context) {
@@ -213,6 +232,8 @@ func deleteOrRecoveryPersonalScheduleByIdCourse(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaActividadPersonal(*deleteValue.CodUsuario, deleteValue.IdPersonalSchedule)
+
 	// Aquí se hace la acutalización
 	result, err := db.Exec("CALL eliminar_actividad_personal (?);", deleteValue.IdPersonalSchedule)
 
@@ -228,18 +249,19 @@ func deleteOrRecoveryPersonalScheduleByIdCourse(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*deleteValue.CodUsuario)
+
 	// Log
 	descripcion := fmt.Sprintf("Se eliminó actividad personal | ID: %d | Usuario ID: %d",
 		deleteValue.IdPersonalSchedule, deleteValue.N_idUsuario)
 
-	go func(uID string, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertLogCod(uID, acc, desc)
-	}(*deleteValue.CodUsuario, "ELIMINAR_ACTIVIDAD_PERSONAL", descripcion)
+	evento := nuevoEvento(c, accionEliminarActividad, objetivoActividad, strconv.Itoa(deleteValue.IdPersonalSchedule))
+	evento.UsuarioID = idUsuarioPorCodigo(*deleteValue.CodUsuario)
+	evento.CodUsuario = *deleteValue.CodUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaActividadPersonal(*deleteValue.CodUsuario, deleteValue.IdPersonalSchedule)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{
 		"message":      "Personal schedule updated successfully",
@@ -262,6 +284,18 @@ func addPersonalActivity(c *gin.Context) {
 		return
 	}
 
+	bloque, err := nuevoBloque(bloquePersonal, 0, personalNewValue.P_nombreCurso,
+		personalNewValue.P_dia, personalNewValue.P_horaInicio, personalNewValue.P_horaFin,
+		&personalNewValue.P_fechaInicio, &personalNewValue.P_fechaFin)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Horario inválido: " + err.Error()})
+		return
+	}
+	conflictos, seguir := verificarConflictos(c, *personalNewValue.CodUsuario, bloque, personalNewValue.AllowConflicts)
+	if !seguir {
+		return
+	}
+
 	/*
 		type NewPersonalActivity struct {
 			P_usuario		int			`json:"P_usuario"`
@@ -316,17 +350,24 @@ func addPersonalActivity(c *gin.Context) {
 			return
 		}
 	*/
+	invalidarCalendario(*personalNewValue.CodUsuario)
+
 	descripcion := "Se creó actividad personal: " + personalNewValue.P_nombreCurso
 
-	insertarLog(
-		personalNewValue.P_usuario,
-		"CREAR_ACTIVIDAD_PERSONAL",
-		descripcion,
-	)
-	c.JSON(200, gin.H{
+	evento := nuevoEvento(c, accionCrearActividadPersonal, objetivoActividad, strconv.Itoa(newActId))
+	evento.UsuarioID = personalNewValue.P_usuario
+	evento.Despues = instantaneaActividadPersonal(*personalNewValue.CodUsuario, newActId)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
+
+	respuesta := gin.H{
 		"message":      "Actividad creada correctamente",
 		"new_activity": newActId,
-	})
+	}
+	if len(conflictos) > 0 {
+		respuesta["warnings"] = conflictos
+	}
+	c.JSON(200, respuesta)
 }
 
 // Get tipo cursos QUERDE AQUIIIIIIIIIIIIIIIII ES DIFERENTE ES OTRO GET
@@ -396,3 +437,54 @@ func GetTiposCurso(c *gin.Context) {
 	// Devuelve la consulta de la base relacional
 	c.JSON(200, tiposCursoArray)
 }
+
+// Actividades personales del usuario (activas y eliminadas)
+func consultarActividadesPersonales(codUsuario string) ([]PersonalSchedule, error) {
+	rows, err := db.Query(`
+		SELECT ao.*
+		FROM ActividadesPersonales ao
+		JOIN Usuarios u ON ao.N_idUsuario = u.N_idUsuario
+		WHERE u.T_codUsuario = ?
+	`, codUsuario)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perschedules []PersonalSchedule
+	for rows.Next() {
+		var perschedule PersonalSchedule
+		err := rows.Scan(
+			&perschedule.N_iduser,
+			&perschedule.N_idcourse,
+			&perschedule.Activity,
+			&perschedule.Description,
+			&perschedule.Dt_Start,
+			&perschedule.Dt_End,
+			&perschedule.Day,
+			&perschedule.StartHour,
+			&perschedule.EndHour,
+			&perschedule.IsDeleted)
+		if err != nil {
+			return nil, err
+		}
+		perschedules = append(perschedules, perschedule)
+	}
+	return perschedules, rows.Err()
+}
+
+// Estado de una actividad personal para las instantáneas de auditoría; nil si no se pudo leer
+func instantaneaActividadPersonal(codUsuario string, idActividad int) *PersonalSchedule {
+	actividades, err := consultarActividadesPersonales(codUsuario)
+	if err != nil {
+		log.Printf("Error leyendo actividad personal para auditoría: %v", err)
+		return nil
+	}
+
+	for i := range actividades {
+		if actividades[i].N_idcourse == idActividad {
+			return &actividades[i]
+		}
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,7 +30,7 @@ func GetRemindersTagsByUserId(c *gin.Context) {
 		err := json.Unmarshal([]byte(val), &remindersArray)
 
 		if err == nil {
-			c.JSON(200, remindersArray)
+			c.JSON(200, conZonaRecordatoriosTags(remindersArray, zonaUsuario(id_User)))
 			return
 
 		}
@@ -85,7 +89,7 @@ func GetRemindersTagsByUserId(c *gin.Context) {
 	}
 
 	// Devuelve la consulta de la base relacional
-	c.JSON(200, remindersArray)
+	c.JSON(200, conZonaRecordatoriosTags(remindersArray, zonaUsuario(id_User)))
 }
 
 // Obtener la lista de los recordatorios
@@ -117,7 +121,7 @@ func GetRemindersByUserId(c *gin.Context) {
 		err := json.Unmarshal([]byte(val), &remindersArray)
 
 		if err == nil {
-			c.JSON(200, remindersArray)
+			c.JSON(200, conZonaRecordatorios(remindersArray, zonaUsuario(id_User)))
 			return
 
 		}
@@ -174,7 +178,22 @@ func GetRemindersByUserId(c *gin.Context) {
 	}
 
 	// Devuelve la consulta de la base relacional
-	c.JSON(200, remindersArray)
+	c.JSON(200, conZonaRecordatorios(remindersArray, zonaUsuario(id_User)))
+}
+
+// Agregan el vencimiento en RFC 3339 en la zona del usuario
+func conZonaRecordatorios(remindersArray []Reminders, zona *time.Location) []Reminders {
+	for i := range remindersArray {
+		remindersArray[i].Vencimiento = rfc3339BD(remindersArray[i].Dt_fechaVencimiento.String, zona)
+	}
+	return remindersArray
+}
+
+func conZonaRecordatoriosTags(remindersArray []RemindersTag, zona *time.Location) []RemindersTag {
+	for i := range remindersArray {
+		remindersArray[i].Vencimiento = rfc3339BD(remindersArray[i].Dt_fechaVencimiento.String, zona)
+	}
+	return remindersArray
 }
 
 // Procedimiento crear recordatorio
@@ -193,6 +212,15 @@ func addReminder(c *gin.Context) {
 		return
 	}
 
+	// La fecha sin desfase está en la zona del usuario; se guarda en la de la institución
+	if reminderNewValue.P_fecha != "" {
+		reminderNewValue.P_fecha, err = fechaClienteBD(reminderNewValue.P_fecha, zonaUsuario(*reminderNewValue.CodUsuario))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "P_fecha debe ser RFC 3339, YYYY-MM-DD HH:MM:SS o YYYY-MM-DD"})
+			return
+		}
+	}
+
 	// Borrar registro de recordatorios de usuario de redis
 	deleted, err2 := rdb.Del(ctx, "Reminders:"+*reminderNewValue.CodUsuario).Result()
 
@@ -263,6 +291,8 @@ func addReminder(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*reminderNewValue.CodUsuario)
+
 	// Log
 
 	log.Printf("ID del ToDo creado: %d", reminderId)
@@ -270,7 +300,11 @@ func addReminder(c *gin.Context) {
 		" | Usuario: " + strconv.Itoa(reminderNewValue.P_usuario) +
 		" | Nombre: " + reminderNewValue.P_nombre
 
-	insertarLog(reminderNewValue.P_usuario, "CREAR_RECORDATORIO", descripcion)
+	evento := nuevoEvento(c, accionCrearRecordatorio, objetivoRecordatorio, strconv.FormatInt(reminderId, 10))
+	evento.UsuarioID = reminderNewValue.P_usuario
+	evento.Despues = instantaneaRecordatorio(porIdRecordatorio, int(reminderId))
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	// Salida
 	c.JSON(200, gin.H{
@@ -296,6 +330,16 @@ func updateReminderById(c *gin.Context) {
 		return
 	}
 
+	// La fecha sin desfase está en la zona del usuario; se guarda en la de la institución
+	if reminderNewValue.P_fecha != nil && *reminderNewValue.P_fecha != "" {
+		fecha, err := fechaClienteBD(*reminderNewValue.P_fecha, zonaUsuario(*reminderNewValue.CodUsuario))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "P_fecha debe ser RFC 3339, YYYY-MM-DD HH:MM:SS o YYYY-MM-DD"})
+			return
+		}
+		reminderNewValue.P_fecha = &fecha
+	}
+
 	// Borrar registro de recordatorios de usuario de redis
 	deleted, err2 := rdb.Del(ctx, "Reminders:"+*reminderNewValue.CodUsuario).Result()
 
@@ -331,6 +375,9 @@ func updateReminderById(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	// Estado previo para la auditoría
+	antes := instantaneaRecordatorio(porIdToDo, reminderNewValue.P_idToDo)
+
 	//	Aquí se hace el llamado al Procedimiento
 	result, err := db.Exec("CALL editar_recordatorio_5tags(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		reminderNewValue.P_idToDo,
@@ -373,18 +420,18 @@ func updateReminderById(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*reminderNewValue.CodUsuario)
+
 	// Log
 	descripcion := fmt.Sprintf("Se actualizó recordatorio | ID_TO_DO: %d | Usuario ID: %d",
 		reminderNewValue.P_idToDo, reminderNewValue.P_usuario)
 
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(reminderNewValue.P_usuario, "UPDATE_RECORDATORIO", descripcion)
+	evento := nuevoEvento(c, accionActualizarRecordatorio, objetivoRecordatorio, strconv.FormatInt(reminderId, 10))
+	evento.UsuarioID = reminderNewValue.P_usuario
+	evento.Antes = antes
+	evento.Despues = instantaneaRecordatorio(porIdToDo, reminderNewValue.P_idToDo)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	// Salida
 	c.JSON(200, gin.H{
@@ -437,6 +484,8 @@ func deleteOrRecoverReminder(c *gin.Context) {
 		fmt.Printf("\nNo es encontró registro relacionado")
 	}
 
+	antes := instantaneaRecordatorio(porIdRecordatorio, delReminder.N_idRecordatorio)
+
 	// Llamado al procedimiento
 	result, err := db.Exec("CALL eliminar_recordatorio(?)", delReminder.N_idRecordatorio)
 	if err != nil {
@@ -445,11 +494,19 @@ func deleteOrRecoverReminder(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*delReminder.CodUsuario)
+
 	descripcion := "Se eliminó recordatorio ID: " +
 		strconv.Itoa(delReminder.N_idRecordatorio) +
 		" | Usuario: " + strconv.Itoa(delReminder.P_usuario)
 
-	insertarLog(delReminder.P_usuario, "ELIMINAR_RECORDATORIO", descripcion)
+	evento := nuevoEvento(c, accionEliminarRecordatorio, objetivoRecordatorio, strconv.Itoa(delReminder.N_idRecordatorio))
+	evento.UsuarioID = delReminder.P_usuario
+	evento.CodUsuario = *delReminder.CodUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaRecordatorio(porIdRecordatorio, delReminder.N_idRecordatorio)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(200, gin.H{
@@ -498,6 +555,12 @@ func deleteMultipleReminder(c *gin.Context) {
 		fmt.Printf("\nNo es encontró registro relacionado")
 	}
 
+	ids := idsDesdeLista(delReminder.N_idRecordatorios)
+	antes, errAntes := consultarRecordatorios(porIdRecordatorio, ids)
+	if errAntes != nil {
+		log.Printf("Error leyendo recordatorios para auditoría: %v", errAntes)
+	}
+
 	// Llamado al procedimiento
 	result, err := db.Exec("CALL eliminar_recordatorios_multiple(?)", delReminder.N_idRecordatorios)
 
@@ -509,21 +572,107 @@ func deleteMultipleReminder(c *gin.Context) {
 		return
 	}
 
+	invalidarCalendario(*delReminder.CodUsuario)
+
 	// Log
 	descripcion := fmt.Sprintf("Se eliminaron los recordatorios | IDs: %s | Usuario ID: %d",
 		delReminder.N_idRecordatorios, delReminder.P_usuario)
 
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(delReminder.P_usuario, "ELIMINAR_MULTIPLES_RECORDATORIOS", descripcion)
+	evento := nuevoEvento(c, accionEliminarRecordatorios, objetivoRecordatorio, delReminder.N_idRecordatorios)
+	evento.UsuarioID = delReminder.P_usuario
+	evento.CodUsuario = *delReminder.CodUsuario
+	evento.Antes = antes
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	c.JSON(200, gin.H{
 		"message":      "Comentario alterado correctamente",
 		"rowsAffected": rowsAffected,
 	})
 }
+
+// Recordatorios por N_idRecordatorio o N_idToDoList, para las instantáneas de auditoría
+func consultarRecordatorios(campo string, ids []int) ([]Reminders, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	marcas := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	// campo solo recibe las constantes de este archivo, nunca datos del cliente
+	rows, err := db.Query("SELECT * FROM RecordatoriosUsuarios WHERE "+campo+" IN ("+marcas+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	return leerRecordatorios(rows)
+}
+
+// Todos los recordatorios del usuario, sin pasar por la caché de Redis
+func recordatoriosDeUsuario(codUsuario string) ([]Reminders, error) {
+	rows, err := db.Query(`
+		SELECT * FROM RecordatoriosUsuarios
+		WHERE N_idUsuario = (SELECT N_idUsuario FROM Usuarios WHERE T_codUsuario = ?)
+	`, codUsuario)
+	if err != nil {
+		return nil, err
+	}
+	return leerRecordatorios(rows)
+}
+
+func leerRecordatorios(rows *sql.Rows) ([]Reminders, error) {
+	defer rows.Close()
+
+	var remindersArray []Reminders
+	for rows.Next() {
+		var reminder Reminders
+		err := rows.Scan(
+			&reminder.N_idToDoList,
+			&reminder.N_idUsuario,
+			&reminder.N_idRecordatorio,
+			&reminder.T_nombre,
+			&reminder.T_descripcion,
+			&reminder.Dt_fechaVencimiento,
+			&reminder.B_isDeleted,
+			&reminder.T_Prioridad,
+			&reminder.B_estado,
+		)
+		if err != nil {
+			return nil, err
+		}
+		remindersArray = append(remindersArray, reminder)
+	}
+	return remindersArray, rows.Err()
+}
+
+const (
+	porIdRecordatorio = "N_idRecordatorio"
+	porIdToDo         = "N_idToDoList"
+)
+
+// Instantánea de un solo recordatorio; nil si no se pudo leer
+func instantaneaRecordatorio(campo string, id int) *Reminders {
+	recordatorios, err := consultarRecordatorios(campo, []int{id})
+	if err != nil {
+		log.Printf("Error leyendo recordatorio para auditoría: %v", err)
+		return nil
+	}
+	if len(recordatorios) == 0 {
+		return nil
+	}
+	return &recordatorios[0]
+}
+
+// Convierte la lista "1,2,3" de /reminders/delete/multiple en ids
+func idsDesdeLista(lista string) []int {
+	var ids []int
+	for _, parte := range strings.Split(lista, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(parte)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
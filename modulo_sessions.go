@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ SESIONES ACTIVAS ------------------------ //
+
+// Cada cuánto se actualiza lastSeen como máximo
+const refrescoUltimoUso = time.Minute
+
+// Registra la sesión de un login. El id se guarda como "jti" del JWT.
+// "session:<sid>" es un hash con los datos y "sessions:<usuario>" el conjunto de ids.
+// "extra" agrega campos al hash (p. ej. "impersonating" en una suplantación).
+func crearSesion(c *gin.Context, usuario string, ttl time.Duration, extra map[string]any) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	sid := hex.EncodeToString(b)
+
+	ahora := time.Now().UTC().Format(time.RFC3339)
+	datos := map[string]any{
+		"user":      usuario,
+		"userAgent": c.Request.UserAgent(),
+		"device":    dispositivoDesdeUA(c.Request.UserAgent()),
+		"ip":        c.ClientIP(),
+		"createdAt": ahora,
+		"lastSeen":  ahora,
+	}
+	for k, v := range extra {
+		datos[k] = v
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(c.Request.Context(), "session:"+sid, datos)
+	pipe.Expire(c.Request.Context(), "session:"+sid, ttl)
+	pipe.SAdd(c.Request.Context(), "sessions:"+usuario, sid)
+	pipe.Expire(c.Request.Context(), "sessions:"+usuario, ttl)
+
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		return "", err
+	}
+	return sid, nil
+}
+
+// Revisa que la sesión del token no haya sido revocada y actualiza lastSeen.
+// Si Redis no responde se devuelve el error: sin poder revisar la revocación
+// no se acepta el token.
+func sesionActiva(c context.Context, claims *Claims) (bool, error) {
+	if claims.ID == "" {
+		return false, nil
+	}
+
+	datos, err := rdb.HMGet(c, "session:"+claims.ID, "user", "lastSeen").Result()
+	if err != nil {
+		return false, err
+	}
+
+	usuario, _ := datos[0].(string)
+	if usuario == "" || usuario != duenoSesion(claims) {
+		return false, nil
+	}
+
+	ultimo, _ := datos[1].(string)
+	if t, err := time.Parse(time.RFC3339, ultimo); err != nil || time.Since(t) > refrescoUltimoUso {
+		rdb.HSet(c, "session:"+claims.ID, "lastSeen", time.Now().UTC().Format(time.RFC3339))
+	}
+	return true, nil
+}
+
+// Dueño de la sesión: en una suplantación es el administrador, no el usuario suplantado
+func duenoSesion(claims *Claims) string {
+	if claims.Act != nil {
+		return claims.Act.Sub
+	}
+	return claims.UserID
+}
+
+// Revoca todas las sesiones del usuario menos "excepto" (puede ir vacío)
+func revocarSesiones(c context.Context, usuario, excepto string) (int, error) {
+	sids, err := rdb.SMembers(c, "sessions:"+usuario).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	revocadas := 0
+	for _, sid := range sids {
+		if sid == excepto {
+			continue
+		}
+		pipe := rdb.TxPipeline()
+		pipe.Del(c, "session:"+sid)
+		pipe.SRem(c, "sessions:"+usuario, sid)
+		if _, err := pipe.Exec(c); err != nil {
+			return revocadas, err
+		}
+		revocadas++
+	}
+	return revocadas, nil
+}
+
+// Nombre corto del dispositivo a partir del User-Agent
+func dispositivoDesdeUA(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return "iOS"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "mac os"):
+		return "macOS"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	default:
+		return "Desconocido"
+	}
+}
+
+// Lista las sesiones del usuario autenticado
+func getSessions(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+	usuario := claims.UserID
+
+	sids, err := rdb.SMembers(c.Request.Context(), "sessions:"+usuario).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	sesiones := []Session{}
+	for _, sid := range sids {
+		datos, err := rdb.HGetAll(c.Request.Context(), "session:"+sid).Result()
+		if err != nil {
+			log.Printf("Error de Redis: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		// La sesión ya expiró: se limpia del conjunto
+		if len(datos) == 0 {
+			rdb.SRem(ctx, "sessions:"+usuario, sid)
+			continue
+		}
+
+		sesiones = append(sesiones, Session{
+			ID:        sid,
+			Device:    datos["device"],
+			UserAgent: datos["userAgent"],
+			IP:        datos["ip"],
+			CreatedAt: datos["createdAt"],
+			LastSeen:  datos["lastSeen"],
+			Current:   sid == claims.ID,
+
+			Impersonating: datos["impersonating"],
+		})
+	}
+
+	sort.Slice(sesiones, func(i, j int) bool {
+		return sesiones[i].LastSeen > sesiones[j].LastSeen
+	})
+
+	c.JSON(200, sesiones)
+}
+
+// Revoca una sesión del usuario autenticado
+func revokeSession(c *gin.Context) {
+	var req RevokeSession
+	if err := c.ShouldBindJSON(&req); err != nil || req.SessionID == "" {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+
+	claims := c.MustGet("user_claims").(*Claims)
+	usuario := claims.UserID
+
+	esSuya, err := rdb.SIsMember(c.Request.Context(), "sessions:"+usuario, req.SessionID).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !esSuya {
+		c.JSON(404, gin.H{"error": "Sesión no encontrada"})
+		return
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(c.Request.Context(), "session:"+req.SessionID)
+	pipe.SRem(c.Request.Context(), "sessions:"+usuario, req.SessionID)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	userID := idUsuarioPorCodigo(usuario)
+	descripcion := fmt.Sprintf("Se revocó sesión | Usuario ID: %d | Sesión: %s", userID, req.SessionID)
+	auditar(c, userID, accionRevocarSesion, objetivoSesion, req.SessionID, descripcion)
+
+	c.JSON(200, gin.H{"message": "Sesión revocada"})
+}
+
+// Revoca todas las sesiones; con exceptCurrent se conserva la actual
+func revokeAllSessions(c *gin.Context) {
+	// Sin cuerpo se revocan todas (exceptCurrent = false)
+	var req RevokeAllSessions
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+
+	claims := c.MustGet("user_claims").(*Claims)
+	usuario := claims.UserID
+
+	excepto := ""
+	if req.ExceptCurrent {
+		excepto = claims.ID
+	}
+
+	revocadas, err := revocarSesiones(c.Request.Context(), usuario, excepto)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	userID := idUsuarioPorCodigo(usuario)
+	descripcion := fmt.Sprintf("Se revocaron todas las sesiones | Usuario ID: %d | Cantidad: %d", userID, revocadas)
+	auditar(c, userID, accionRevocarSesiones, objetivoUsuario, usuario, descripcion)
+
+	c.JSON(200, gin.H{
+		"message":   "Sesiones revocadas",
+		"revocadas": revocadas,
+	})
+}
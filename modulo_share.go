@@ -0,0 +1,456 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//	------------------------ ENLACES PARA COMPARTIR EL HORARIO ------------------------ //
+
+// En Redis, con el mismo esquema que el feed de calendario (solo el hash del token):
+//   share:<sha256>        -> {owner, id, scope, password (bcrypt), creado, expira}, con TTL
+//   sharelinks:<codUsuario> -> id -> sha256
+//   share:intentos:<sha256> -> contraseñas equivocadas en la ventana actual
+
+const (
+	alcanceOficial         = "official"
+	alcanceOficialPersonal = "official_personal"
+
+	vigenciaEnlaceHoras    = 7 * 24
+	vigenciaMaxEnlaceHoras = 90 * 24
+
+	maxIntentosEnlace     = 10
+	ventanaIntentosEnlace = 15 * time.Minute
+)
+
+// Fila del horario compartido: sin descripciones ni datos del dueño
+type EntradaCompartida struct {
+	Tipo       string `json:"tipo"`
+	Nombre     string `json:"nombre"`
+	Dia        int    `json:"dia"`
+	HoraInicio string `json:"horaInicio"`
+	HoraFin    string `json:"horaFin"`
+	Nrc        string `json:"nrc,omitempty"`
+	Docente    string `json:"docente,omitempty"`
+	Salon      string `json:"salon,omitempty"`
+	Sede       string `json:"sede,omitempty"`
+}
+
+func createShareLink(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req EnlaceHorarioRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = alcanceOficial
+	}
+	if req.Scope != alcanceOficial && req.Scope != alcanceOficialPersonal {
+		c.JSON(400, gin.H{"error": "scope debe ser official u official_personal"})
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = vigenciaEnlaceHoras
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > vigenciaMaxEnlaceHoras {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("expiresInHours debe estar entre 1 y %d", vigenciaMaxEnlaceHoras)})
+		return
+	}
+
+	var hashPassword string
+	if req.Password != "" {
+		if len(req.Password) < 4 || len(req.Password) > 72 {
+			c.JSON(400, gin.H{"error": "La contraseña debe tener entre 4 y 72 caracteres"})
+			return
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Printf("Error generando hash: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		hashPassword = string(h)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generando token: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	hash := hashTokenFeed(token)
+	id := hash[:16]
+
+	vigencia := time.Duration(req.ExpiresInHours) * time.Hour
+	creado := time.Now().UTC()
+	expira := creado.Add(vigencia)
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(c.Request.Context(), "share:"+hash,
+		"owner", claims.UserID,
+		"id", id,
+		"scope", req.Scope,
+		"password", hashPassword,
+		"creado", creado.Format(time.RFC3339),
+		"expira", expira.Format(time.RFC3339),
+	)
+	pipe.Expire(c.Request.Context(), "share:"+hash, vigencia)
+	pipe.HSet(c.Request.Context(), "sharelinks:"+claims.UserID, id, hash)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionCrearEnlaceHorario, objetivoEnlaceHorario, id,
+		fmt.Sprintf("Se creó enlace para compartir el horario | Alcance: %s | Expira: %s | Usuario: %s",
+			req.Scope, expira.Format(time.RFC3339), claims.UserID))
+
+	ruta := "/api/v1/share/" + token
+	respuesta := gin.H{
+		"id":          id,
+		"token":       token,
+		"path":        ruta,
+		"scope":       req.Scope,
+		"hasPassword": hashPassword != "",
+		"createdAt":   creado.Format(time.RFC3339),
+		"expiresAt":   expira.Format(time.RFC3339),
+	}
+	// Mismo prefijo público que el feed de calendario
+	if base := strings.TrimSuffix(os.Getenv("CALENDAR_FEED_BASE_URL"), "/"); base != "" {
+		respuesta["url"] = base + ruta
+		respuesta["htmlUrl"] = base + ruta + ".html"
+	}
+
+	c.JSON(200, respuesta)
+}
+
+// Enlaces vigentes del usuario; los vencidos se limpian al listarlos
+func getShareLinks(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	ids, err := rdb.HGetAll(c.Request.Context(), "sharelinks:"+claims.UserID).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	enlaces := []gin.H{}
+	for id, hash := range ids {
+		datos, err := rdb.HGetAll(c.Request.Context(), "share:"+hash).Result()
+		if err != nil {
+			log.Printf("Error de Redis: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if len(datos) == 0 {
+			rdb.HDel(c.Request.Context(), "sharelinks:"+claims.UserID, id)
+			continue
+		}
+		enlaces = append(enlaces, gin.H{
+			"id":          id,
+			"scope":       datos["scope"],
+			"hasPassword": datos["password"] != "",
+			"createdAt":   datos["creado"],
+			"expiresAt":   datos["expira"],
+		})
+	}
+	slices.SortFunc(enlaces, func(a, b gin.H) int {
+		return strings.Compare(a["createdAt"].(string), b["createdAt"].(string))
+	})
+
+	c.JSON(200, enlaces)
+}
+
+func revokeShareLink(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req RevocarEnlaceRequest
+	if err := c.BindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+
+	hash, err := rdb.HGet(c.Request.Context(), "sharelinks:"+claims.UserID, req.ID).Result()
+	if errors.Is(err, redis.Nil) {
+		c.JSON(404, gin.H{"error": "Enlace no encontrado"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(c.Request.Context(), "share:"+hash, "share:intentos:"+hash)
+	pipe.HDel(c.Request.Context(), "sharelinks:"+claims.UserID, req.ID)
+	if _, err := pipe.Exec(c.Request.Context()); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionRevocarEnlaceHorario, objetivoEnlaceHorario, req.ID,
+		"Se revocó enlace para compartir el horario | Usuario: "+claims.UserID)
+
+	c.JSON(200, gin.H{"message": "Enlace revocado"})
+}
+
+// Vista pública del horario compartido. Con ".html" al final del token se
+// devuelve una tabla; si no, JSON. La contraseña llega en X-Share-Password o,
+// desde el formulario HTML, en el campo password (POST).
+func getSharedSchedule(c *gin.Context) {
+	token := c.Param("token")
+	html := strings.HasSuffix(token, ".html")
+	token = strings.TrimSuffix(token, ".html")
+	hash := hashTokenFeed(token)
+
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Robots-Tag", "noindex")
+
+	datos, err := rdb.HGetAll(c.Request.Context(), "share:"+hash).Result()
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if len(datos) == 0 {
+		if html {
+			renderizarCompartido(c, 404, vistaCompartida{Mensaje: "Este enlace no existe o ya venció."})
+			return
+		}
+		c.JSON(404, gin.H{"error": "Enlace no encontrado o vencido"})
+		return
+	}
+
+	if datos["password"] != "" {
+		password := c.GetHeader("X-Share-Password")
+		if password == "" {
+			password = c.PostForm("password")
+		}
+		if msg, estado := verificarPasswordEnlace(c, hash, datos["password"], password); estado != 200 {
+			if html {
+				renderizarCompartido(c, estado, vistaCompartida{PidePassword: true, Mensaje: msg})
+				return
+			}
+			c.JSON(estado, gin.H{"error": msg})
+			return
+		}
+	}
+
+	entradas, err := horarioCompartido(datos["owner"], datos["scope"])
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if html {
+		renderizarCompartido(c, 200, vistaCompartida{
+			Entradas: entradas,
+			Expira:   datos["expira"],
+			Zona:     zonaInstitucion.String(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"scope":     datos["scope"],
+		"expiresAt": datos["expira"],
+		"timezone":  zonaInstitucion.String(),
+		"entries":   entradas,
+	})
+}
+
+// Compara la contraseña y cuenta los fallos por enlace para frenar la fuerza bruta
+func verificarPasswordEnlace(c *gin.Context, hash, hashPassword, password string) (string, int) {
+	clave := "share:intentos:" + hash
+
+	// Sin contraseña no es un intento: solo se muestra el formulario o el bloqueo
+	if password == "" {
+		intentos, err := rdb.Get(c.Request.Context(), clave).Int()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("Error de Redis: %v", err)
+			return "Internal server error", 500
+		}
+		if intentos >= maxIntentosEnlace {
+			return "Demasiados intentos, intente más tarde", 429
+		}
+		return "Este enlace requiere contraseña", 401
+	}
+
+	// El intento se cuenta antes de comparar, así las peticiones simultáneas no
+	// pueden pasar todas del límite; si la contraseña es correcta se descuenta
+	intentos, err := incrementarEnVentana(c.Request.Context(), clave, ventanaIntentosEnlace)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		return "Internal server error", 500
+	}
+	if intentos > maxIntentosEnlace {
+		return "Demasiados intentos, intente más tarde", 429
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password)) != nil {
+		return "Contraseña incorrecta", 401
+	}
+	if err := rdb.Decr(c.Request.Context(), clave).Err(); err != nil {
+		log.Printf("Error de Redis: %v", err)
+	}
+	return "", 200
+}
+
+// Clases de periodos que no han terminado y, según el alcance, actividades
+// personales vigentes, ordenadas por día y hora
+func horarioCompartido(codUsuario, alcance string) ([]EntradaCompartida, error) {
+	hoy := time.Now().In(zonaInstitucion)
+	hoy = time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, zonaInstitucion)
+	vigente := func(fin string) bool {
+		t, err := leerFechaBD(fin)
+		return fin == "" || err != nil || !t.Before(hoy)
+	}
+
+	entradas := []EntradaCompartida{}
+
+	clases, err := consultarHorarioOficial(codUsuario)
+	if err != nil {
+		return nil, err
+	}
+	for _, clase := range clases {
+		if !vigente(clase.FechaFinal) {
+			continue
+		}
+		entradas = append(entradas, EntradaCompartida{
+			Tipo:       bloqueOficial,
+			Nombre:     clase.Course,
+			Dia:        clase.Day,
+			HoraInicio: clase.StartHour,
+			HoraFin:    clase.EndHour,
+			Nrc:        clase.Nrc,
+			Docente:    clase.Teacher,
+			Salon:      clase.Classroom,
+			Sede:       clase.Campus,
+		})
+	}
+
+	if alcance == alcanceOficialPersonal {
+		actividades, err := consultarActividadesPersonales(codUsuario)
+		if err != nil {
+			return nil, err
+		}
+		for _, actividad := range actividades {
+			if eliminadoNulo(actividad.IsDeleted) || (actividad.Dt_End.Valid && !vigente(actividad.Dt_End.String)) {
+				continue
+			}
+			entradas = append(entradas, EntradaCompartida{
+				Tipo:       bloquePersonal,
+				Nombre:     actividad.Activity,
+				Dia:        actividad.Day,
+				HoraInicio: actividad.StartHour,
+				HoraFin:    actividad.EndHour,
+			})
+		}
+	}
+
+	slices.SortStableFunc(entradas, func(a, b EntradaCompartida) int {
+		if a.Dia != b.Dia {
+			return a.Dia - b.Dia
+		}
+		return strings.Compare(a.HoraInicio, b.HoraInicio)
+	})
+	return entradas, nil
+}
+
+type vistaCompartida struct {
+	Mensaje      string
+	PidePassword bool
+	Entradas     []EntradaCompartida
+	Expira       string
+	Zona         string
+}
+
+var nombresDias = []string{"Lunes", "Martes", "Miércoles", "Jueves", "Viernes", "Sábado", "Domingo"}
+
+var plantillaCompartida = template.Must(template.New("horario").Funcs(template.FuncMap{
+	"dias": func() []string { return nombresDias },
+	"delDia": func(entradas []EntradaCompartida, i int) []EntradaCompartida {
+		var delDia []EntradaCompartida
+		for _, e := range entradas {
+			if e.Dia == i+1 {
+				delDia = append(delDia, e)
+			}
+		}
+		return delDia
+	},
+	"hora": func(valor string) string {
+		if len(valor) > 5 {
+			return valor[:5]
+		}
+		return valor
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Horario compartido</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5rem; color: #222; }
+table { border-collapse: collapse; width: 100%; table-layout: fixed; }
+th, td { border: 1px solid #ccc; padding: .4rem; vertical-align: top; }
+th { background: #f2f2f2; }
+.bloque { border-radius: 4px; padding: .3rem; margin-bottom: .3rem; font-size: .85rem; }
+.oficial { background: #dbe9ff; }
+.personal { background: #e3f5e1; }
+.hora { font-weight: bold; }
+small { color: #666; }
+</style>
+</head>
+<body>
+<h1>Horario compartido</h1>
+{{if .Mensaje}}<p>{{.Mensaje}}</p>{{end}}
+{{if .PidePassword}}
+<form method="post">
+<label>Contraseña <input type="password" name="password" autofocus></label>
+<button type="submit">Ver horario</button>
+</form>
+{{else if .Entradas}}
+<table>
+<tr>{{range dias}}<th>{{.}}</th>{{end}}</tr>
+<tr>{{range $i, $d := dias}}<td>{{range delDia $.Entradas $i}}
+<div class="bloque {{.Tipo}}"><div class="hora">{{hora .HoraInicio}} - {{hora .HoraFin}}</div>{{.Nombre}}{{if .Salon}}<br><small>{{.Salon}}{{if .Sede}} · {{.Sede}}{{end}}</small>{{end}}{{if .Docente}}<br><small>{{.Docente}}</small>{{end}}</div>
+{{end}}</td>{{end}}</tr>
+</table>
+<p><small>Horas en {{.Zona}}. Enlace válido hasta {{.Expira}}.</small></p>
+{{else if not .Mensaje}}
+<p>No hay clases ni actividades para mostrar.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func renderizarCompartido(c *gin.Context, estado int, vista vistaCompartida) {
+	var b strings.Builder
+	if err := plantillaCompartida.Execute(&b, vista); err != nil {
+		log.Printf("Error generando horario compartido: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.Data(estado, "text/html; charset=utf-8", []byte(b.String()))
+}
@@ -185,6 +185,8 @@ func deleteTag(c *gin.Context) {
 		fmt.Printf("\nNo se encontró registro relacionado")
 	}
 
+	antes := instantaneaEtiqueta(delTag.N_idEtiqueta)
+
 	// Llamado al procedimiento
 	result, err := db.Exec("CALL eliminar_etiqueta(?)", delTag.N_idEtiqueta)
 
@@ -198,7 +200,13 @@ func deleteTag(c *gin.Context) {
 		strconv.Itoa(delTag.N_idEtiqueta) +
 		" | Usuario ID: " + strconv.Itoa(delTag.P_usuario)
 
-	insertarLog(delTag.P_usuario, "ELIMINAR_ETIQUETA", descripcion)
+	evento := nuevoEvento(c, accionEliminarEtiqueta, objetivoEtiqueta, strconv.Itoa(delTag.N_idEtiqueta))
+	evento.UsuarioID = delTag.P_usuario
+	evento.CodUsuario = *delTag.CodUsuario
+	evento.Antes = antes
+	evento.Despues = instantaneaEtiqueta(delTag.N_idEtiqueta)
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(200, gin.H{
@@ -206,3 +214,31 @@ func deleteTag(c *gin.Context) {
 		"rowsAffected": rowsAffected,
 	})
 }
+
+// Filas de una etiqueta (una por recordatorio) para las instantáneas de auditoría
+func instantaneaEtiqueta(idEtiqueta int) []Tags {
+	rows, err := db.Query(`SELECT * FROM EtiquetasRecordatorios WHERE N_idEtiqueta = ?`, idEtiqueta)
+	if err != nil {
+		log.Printf("Error leyendo etiqueta para auditoría: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var TagsArray []Tags
+	for rows.Next() {
+		var Tags Tags
+		err := rows.Scan(
+			&Tags.N_idUsuario,
+			&Tags.N_idRecordatorio,
+			&Tags.N_idEtiqueta,
+			&Tags.T_nombre,
+			&Tags.B_isDeleted,
+		)
+		if err != nil {
+			log.Printf("Error leyendo etiqueta para auditoría: %v", err)
+			return nil
+		}
+		TagsArray = append(TagsArray, Tags)
+	}
+	return TagsArray
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ HORARIO IMPRIMIBLE (PDF / PNG) ------------------------ //
+
+// Colores por defecto si el usuario no tiene paleta guardada
+var paletaPorDefecto = []string{"#4E79A7", "#F28E2B", "#59A14F", "#E15759", "#76B7B2", "#EDC948", "#B07AA1", "#FF9DA7"}
+
+// Una fila del horario semanal que se dibuja en la grilla
+type bloqueImpresion struct {
+	titulo   string
+	detalle  string
+	dia      int
+	inicio   time.Duration
+	fin      time.Duration
+	color    color.RGBA
+	carril   int
+	carriles int
+}
+
+type horarioImpresion struct {
+	titulo  string
+	periodo string
+	bloques []bloqueImpresion
+}
+
+// Descarga la grilla semanal de un periodo académico como PDF o PNG
+func exportTimetable(c *gin.Context) {
+	codUsuario := c.Param("id")
+
+	formato := c.DefaultQuery("format", "pdf")
+	if formato != "pdf" && formato != "png" {
+		c.JSON(400, gin.H{"error": "format debe ser pdf o png"})
+		return
+	}
+	idPeriodo := 0
+	if valor := c.Query("period"); valor != "" {
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 1 {
+			c.JSON(400, gin.H{"error": "period debe ser el id de un periodo académico"})
+			return
+		}
+		idPeriodo = n
+	}
+
+	horario, err := armarHorarioImpresion(codUsuario, idPeriodo)
+	if errors.Is(err, errPeriodoNoEncontrado) {
+		c.JSON(404, gin.H{"error": "Periodo académico no encontrado"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	nombre := "horario-" + codUsuario
+	if horario.periodo != "" {
+		nombre += "-" + strings.ReplaceAll(horario.periodo, " ", "_")
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+nombre+`.`+formato+`"`)
+	if formato == "png" {
+		imagen, err := dibujarPNG(horario)
+		if err != nil {
+			log.Printf("Error generando PNG: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.Data(200, "image/png", imagen)
+		return
+	}
+	c.Data(200, "application/pdf", dibujarPDF(horario))
+}
+
+var errPeriodoNoEncontrado = errors.New("periodo no encontrado")
+
+// Clases del periodo y actividades personales activas que se cruzan con sus fechas.
+// Sin periodo se usa el vigente hoy o, si no hay, el último del usuario; si el
+// usuario no tiene clases, la grilla lleva solo sus actividades personales.
+func armarHorarioImpresion(codUsuario string, idPeriodo int) (horarioImpresion, error) {
+	var h horarioImpresion
+
+	clases, err := consultarHorarioOficial(codUsuario)
+	if err != nil {
+		return h, err
+	}
+	if idPeriodo == 0 {
+		idPeriodo = periodoActual(clases)
+	}
+
+	var desde, hasta string
+	var delPeriodo []OfficialSchedule
+	for _, clase := range clases {
+		if clase.N_idPeriodoAcademico == idPeriodo {
+			delPeriodo = append(delPeriodo, clase)
+			h.periodo, desde, hasta = clase.Periodo_academico, clase.FechaInicio, clase.FechaFinal
+		}
+	}
+	if len(delPeriodo) == 0 && idPeriodo != 0 {
+		periodo, err := consultarPeriodo(idPeriodo)
+		if err != nil {
+			return h, err
+		}
+		if periodo == nil {
+			return h, errPeriodoNoEncontrado
+		}
+		h.periodo, desde, hasta = periodo.T_nombre, periodo.Dt_fechaInicio, periodo.Dt_fechaFinal
+	}
+	h.titulo = strings.TrimSpace("Horario " + h.periodo)
+
+	actividades, err := consultarActividadesPersonales(codUsuario)
+	if err != nil {
+		return h, err
+	}
+
+	colores := paletaUsuario(codUsuario)
+	colorDe := map[string]color.RGBA{}
+	asignar := func(titulo string) color.RGBA {
+		if col, ok := colorDe[titulo]; ok {
+			return col
+		}
+		col := colores[len(colorDe)%len(colores)]
+		colorDe[titulo] = col
+		return col
+	}
+
+	slices.SortFunc(delPeriodo, func(a, b OfficialSchedule) int { return strings.Compare(a.Course, b.Course) })
+	for _, clase := range delPeriodo {
+		b, err := nuevoBloque(bloqueOficial, clase.N_idHorario, clase.Course, clase.Day, clase.StartHour, clase.EndHour, nil, nil)
+		if err != nil {
+			log.Printf("Clase %d omitida del horario imprimible: %v", clase.N_idHorario, err)
+			continue
+		}
+		detalle := strings.Trim(clase.Classroom+" · "+clase.Campus, " ·")
+		h.bloques = append(h.bloques, bloqueImpresion{
+			titulo: clase.Course, detalle: detalle, dia: b.Dia, inicio: b.inicio, fin: b.fin, color: asignar(clase.Course),
+		})
+	}
+
+	inicioPeriodo, err1 := leerFechaBD(desde)
+	finPeriodo, err2 := leerFechaBD(hasta)
+	for _, actividad := range actividades {
+		if eliminadoNulo(actividad.IsDeleted) {
+			continue
+		}
+		var fi, ff *string
+		if actividad.Dt_Start.Valid {
+			fi = &actividad.Dt_Start.String
+		}
+		if actividad.Dt_End.Valid {
+			ff = &actividad.Dt_End.String
+		}
+		b, err := nuevoBloque(bloquePersonal, actividad.N_idcourse, actividad.Activity, actividad.Day, actividad.StartHour, actividad.EndHour, fi, ff)
+		if err != nil {
+			log.Printf("Actividad %d omitida del horario imprimible: %v", actividad.N_idcourse, err)
+			continue
+		}
+		// Solo las que tienen al menos una fecha dentro del periodo
+		if err1 == nil && err2 == nil && len(b.fechas(inicioPeriodo, finPeriodo)) == 0 {
+			continue
+		}
+		h.bloques = append(h.bloques, bloqueImpresion{
+			titulo: actividad.Activity, detalle: "Personal", dia: b.Dia, inicio: b.inicio, fin: b.fin, color: asignar(actividad.Activity),
+		})
+	}
+
+	asignarCarriles(h.bloques)
+	return h, nil
+}
+
+// El periodo cuyas fechas incluyen hoy o, si no hay, el que terminó más tarde
+func periodoActual(clases []OfficialSchedule) int {
+	hoy := time.Now().In(zonaInstitucion).Format(time.DateOnly)
+	id, ultimo := 0, ""
+	for _, clase := range clases {
+		inicio, fin := recortarFecha(clase.FechaInicio), recortarFecha(clase.FechaFinal)
+		if inicio <= hoy && hoy <= fin {
+			return clase.N_idPeriodoAcademico
+		}
+		if fin > ultimo {
+			id, ultimo = clase.N_idPeriodoAcademico, fin
+		}
+	}
+	return id
+}
+
+func recortarFecha(valor string) string {
+	if len(valor) > 10 {
+		return valor[:10]
+	}
+	return valor
+}
+
+// Bloques que se cruzan el mismo día se dibujan lado a lado: cada uno toma el
+// primer carril libre y todos los del día se reparten el ancho de la columna
+func asignarCarriles(bloques []bloqueImpresion) {
+	slices.SortStableFunc(bloques, func(a, b bloqueImpresion) int {
+		if a.dia != b.dia {
+			return a.dia - b.dia
+		}
+		return int(a.inicio - b.inicio)
+	})
+
+	carrilesDia := map[int]int{}
+	for i := range bloques {
+		var finCarril []time.Duration
+		for j := 0; j < i; j++ {
+			if bloques[j].dia != bloques[i].dia {
+				continue
+			}
+			for len(finCarril) <= bloques[j].carril {
+				finCarril = append(finCarril, 0)
+			}
+			finCarril[bloques[j].carril] = max(finCarril[bloques[j].carril], bloques[j].fin)
+		}
+		carril := 0
+		for carril < len(finCarril) && finCarril[carril] > bloques[i].inicio {
+			carril++
+		}
+		bloques[i].carril = carril
+		carrilesDia[bloques[i].dia] = max(carrilesDia[bloques[i].dia], carril+1)
+	}
+	for i := range bloques {
+		bloques[i].carriles = carrilesDia[bloques[i].dia]
+	}
+}
+
+var colorHex = regexp.MustCompile(`#([0-9a-fA-F]{6}|[0-9a-fA-F]{3})\b`)
+
+// Colores de la paleta guardada en palette:<id>, en el orden en que aparecen.
+// La paleta se guarda como texto libre desde el front; se toma cualquier #RRGGBB o #RGB.
+func paletaUsuario(codUsuario string) []color.RGBA {
+	valor, err := rdb.Get(ctx, "palette:"+codUsuario).Result()
+	if errors.Is(err, redis.Nil) {
+		if id := idUsuarioPorCodigo(codUsuario); id != 0 {
+			valor, err = rdb.Get(ctx, "palette:"+strconv.Itoa(id)).Result()
+		}
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Error de Redis leyendo paleta: %v", err)
+	}
+
+	colores := leerPaleta(valor)
+	if len(colores) == 0 {
+		colores = leerPaleta(strings.Join(paletaPorDefecto, " "))
+	}
+	return colores
+}
+
+func leerPaleta(valor string) []color.RGBA {
+	var colores []color.RGBA
+	for _, m := range colorHex.FindAllStringSubmatch(valor, -1) {
+		hex := m[1]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		n, _ := strconv.ParseUint(hex, 16, 32)
+		colores = append(colores, color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 255})
+	}
+	return colores
+}
+
+// Texto negro o blanco según la luminancia del fondo
+func colorTexto(fondo color.RGBA) color.RGBA {
+	if 299*int(fondo.R)+587*int(fondo.G)+114*int(fondo.B) > 150000 {
+		return color.RGBA{0x22, 0x22, 0x22, 255}
+	}
+	return color.RGBA{255, 255, 255, 255}
+}
+
+func formatoHoraCorta(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"time"
+)
+
+//	------------------------ DIBUJO DEL HORARIO IMPRIMIBLE ------------------------ //
+
+// Hoja A4 horizontal en puntos; el PNG usa las mismas medidas multiplicadas por escalaPNG
+const (
+	anchoHoja  = 842.0
+	altoHoja   = 595.0
+	margenHoja = 28.0
+	escalaPNG  = 2
+)
+
+var (
+	colorLinea    = color.RGBA{0xDD, 0xDD, 0xDD, 255}
+	colorCabecera = color.RGBA{0xF2, 0xF2, 0xF2, 255}
+	colorTinta    = color.RGBA{0x22, 0x22, 0x22, 255}
+	colorSuave    = color.RGBA{0x77, 0x77, 0x77, 255}
+	colorFondo    = color.RGBA{255, 255, 255, 255}
+)
+
+// Superficie de dibujo con origen arriba a la izquierda, en puntos
+type lienzo interface {
+	rect(x, y, w, h float64, relleno color.RGBA)
+	// y es el borde superior del texto
+	texto(x, y, tam float64, negrita bool, s string, col color.RGBA)
+	ancho(s string, tam float64, negrita bool) float64
+}
+
+func dibujarHorario(l lienzo, h horarioImpresion) {
+	l.rect(0, 0, anchoHoja, altoHoja, colorFondo)
+	l.texto(margenHoja, margenHoja, 16, true, h.titulo, colorTinta)
+	generado := "Generado " + time.Now().In(zonaInstitucion).Format("2006-01-02 15:04")
+	l.texto(anchoHoja-margenHoja-l.ancho(generado, 8, false), margenHoja+5, 8, false, generado, colorSuave)
+
+	// Lunes a sábado, y domingo solo si hay algo ese día
+	dias := 6
+	desde, hasta := 7*time.Hour, 19*time.Hour
+	for _, b := range h.bloques {
+		if b.dia == 7 {
+			dias = 7
+		}
+		desde = min(desde, b.inicio.Truncate(time.Hour))
+		hasta = max(hasta, (b.fin + time.Hour - 1).Truncate(time.Hour))
+	}
+	horas := int((hasta - desde) / time.Hour)
+
+	const columnaHoras, altoCabecera = 40.0, 20.0
+	izquierda, arriba := margenHoja+columnaHoras, margenHoja+32
+	anchoDia := (anchoHoja - margenHoja - izquierda) / float64(dias)
+	altoHora := (altoHoja - margenHoja - arriba - altoCabecera) / float64(horas)
+	cuerpo := arriba + altoCabecera
+
+	// Cabecera con los días
+	l.rect(izquierda, arriba, anchoDia*float64(dias), altoCabecera, colorCabecera)
+	for i := 0; i < dias; i++ {
+		x := izquierda + float64(i)*anchoDia
+		nombre := nombresDias[i]
+		l.texto(x+(anchoDia-l.ancho(nombre, 9, true))/2, arriba+6, 9, true, nombre, colorTinta)
+	}
+
+	// Líneas de cada hora y de cada día
+	for i := 0; i <= horas; i++ {
+		y := cuerpo + float64(i)*altoHora
+		l.rect(izquierda, y, anchoDia*float64(dias), 0.5, colorLinea)
+		if i < horas {
+			l.texto(margenHoja, y+2, 7, false, formatoHoraCorta(desde+time.Duration(i)*time.Hour), colorSuave)
+		}
+	}
+	for i := 0; i <= dias; i++ {
+		l.rect(izquierda+float64(i)*anchoDia, arriba, 0.5, altoCabecera+float64(horas)*altoHora, colorLinea)
+	}
+
+	for _, b := range h.bloques {
+		ancho := anchoDia / float64(b.carriles)
+		x := izquierda + float64(b.dia-1)*anchoDia + float64(b.carril)*ancho + 1
+		y := cuerpo + float64(b.inicio-desde)/float64(time.Hour)*altoHora + 1
+		alto := float64(b.fin-b.inicio)/float64(time.Hour)*altoHora - 2
+		ancho -= 2
+		l.rect(x, y, ancho, alto, b.color)
+
+		tinta := colorTexto(b.color)
+		lineas := []struct {
+			texto   string
+			tam     float64
+			negrita bool
+		}{
+			{b.titulo, 8, true},
+			{formatoHoraCorta(b.inicio) + " - " + formatoHoraCorta(b.fin), 7, false},
+			{b.detalle, 7, false},
+		}
+		cursor := y + 3
+		for _, linea := range lineas {
+			if linea.texto == "" || cursor+linea.tam > y+alto {
+				continue
+			}
+			l.texto(x+3, cursor, linea.tam, linea.negrita, truncarTexto(l, linea.texto, linea.tam, linea.negrita, ancho-6), tinta)
+			cursor += linea.tam + 2
+		}
+	}
+}
+
+// Recorta el texto con "..." para que quepa en el ancho
+func truncarTexto(l lienzo, s string, tam float64, negrita bool, maximo float64) string {
+	if l.ancho(s, tam, negrita) <= maximo {
+		return s
+	}
+	runas := []rune(s)
+	for len(runas) > 0 && l.ancho(string(runas)+"...", tam, negrita) > maximo {
+		runas = runas[:len(runas)-1]
+	}
+	if len(runas) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(string(runas)) + "..."
+}
+
+//	------------------------ PDF ------------------------ //
+
+// PDF de una página con Helvetica, que todo lector trae, así no hay que incrustar fuentes
+type lienzoPDF struct {
+	contenido bytes.Buffer
+}
+
+func (p *lienzoPDF) color(col color.RGBA) string {
+	return fmt.Sprintf("%.3f %.3f %.3f rg", float64(col.R)/255, float64(col.G)/255, float64(col.B)/255)
+}
+
+func (p *lienzoPDF) rect(x, y, w, h float64, relleno color.RGBA) {
+	fmt.Fprintf(&p.contenido, "%s %.2f %.2f %.2f %.2f re f\n", p.color(relleno), x, altoHoja-y-h, w, h)
+}
+
+func (p *lienzoPDF) texto(x, y, tam float64, negrita bool, s string, col color.RGBA) {
+	fuente := "F1"
+	if negrita {
+		fuente = "F2"
+	}
+	fmt.Fprintf(&p.contenido, "BT /%s %.1f Tf %s %.2f %.2f Td (%s) Tj ET\n",
+		fuente, tam, p.color(col), x, altoHoja-y-tam*0.8, textoPDF(s))
+}
+
+// Aproximación de los anchos de Helvetica (en milésimas del tamaño)
+func (p *lienzoPDF) ancho(s string, tam float64, negrita bool) float64 {
+	total := 0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("iljtfrI.,:;' ·|!", r):
+			total += 280
+		case strings.ContainsRune("mwMW", r):
+			total += 833
+		case r >= 'A' && r <= 'Z', strings.ContainsRune("ÁÉÍÓÚÑÜ", r):
+			total += 667
+		default:
+			total += 556
+		}
+	}
+	if negrita {
+		total = total * 106 / 100
+	}
+	return float64(total) * tam / 1000
+}
+
+// Cadena literal de PDF en WinAnsiEncoding: Latin-1 cubre tildes y eñes
+func textoPDF(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func dibujarPDF(h horarioImpresion) []byte {
+	p := &lienzoPDF{}
+	dibujarHorario(p, h)
+
+	objetos := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>", anchoHoja, altoHoja),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.contenido.Len(), p.contenido.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	posiciones := make([]int, len(objetos))
+	for i, obj := range objetos {
+		posiciones[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objetos)+1)
+	for _, pos := range posiciones {
+		fmt.Fprintf(&b, "%010d 00000 n \n", pos)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objetos)+1, xref)
+	return b.Bytes()
+}
+
+//	------------------------ PNG ------------------------ //
+
+// Imagen con una fuente de mapa de bits 5x7 propia (solo mayúsculas, sin tildes)
+type lienzoPNG struct {
+	img *image.RGBA
+}
+
+func (p *lienzoPNG) rect(x, y, w, h float64, relleno color.RGBA) {
+	r := image.Rect(
+		int(math.Round(x*escalaPNG)), int(math.Round(y*escalaPNG)),
+		int(math.Round((x+w)*escalaPNG)), int(math.Round((y+h)*escalaPNG)),
+	)
+	if r.Dy() == 0 {
+		r.Max.Y++
+	}
+	if r.Dx() == 0 {
+		r.Max.X++
+	}
+	draw.Draw(p.img, r, &image.Uniform{relleno}, image.Point{}, draw.Src)
+}
+
+// Píxeles por punto de la fuente para un tamaño en puntos
+func escalaFuente(tam float64) int {
+	return max(1, int(tam*escalaPNG*0.72/7+0.5))
+}
+
+func (p *lienzoPNG) texto(x, y, tam float64, negrita bool, s string, col color.RGBA) {
+	e := escalaFuente(tam)
+	px, py := int(math.Round(x*escalaPNG)), int(math.Round(y*escalaPNG))
+	for _, r := range textoMapaBits(s) {
+		glifo, ok := fuenteMapaBits[r]
+		if !ok {
+			glifo = fuenteMapaBits['?']
+		}
+		for fila, bits := range glifo {
+			for columna, bit := range bits {
+				if bit != '#' {
+					continue
+				}
+				celda := image.Rect(px+columna*e, py+fila*e, px+(columna+1)*e, py+(fila+1)*e)
+				if negrita {
+					celda.Max.X++
+				}
+				draw.Draw(p.img, celda, &image.Uniform{col}, image.Point{}, draw.Src)
+			}
+		}
+		px += 6 * e
+	}
+}
+
+func (p *lienzoPNG) ancho(s string, tam float64, negrita bool) float64 {
+	return float64(len([]rune(textoMapaBits(s))) * 6 * escalaFuente(tam) / escalaPNG)
+}
+
+var sinTildes = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N", "À", "A", "È", "E", "Ì", "I", "Ò", "O", "Ù", "U")
+
+func textoMapaBits(s string) string {
+	return sinTildes.Replace(strings.ToUpper(s))
+}
+
+func dibujarPNG(h horarioImpresion) ([]byte, error) {
+	p := &lienzoPNG{img: image.NewRGBA(image.Rect(0, 0, int(anchoHoja*escalaPNG), int(altoHoja*escalaPNG)))}
+	dibujarHorario(p, h)
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, p.img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var fuenteMapaBits = map[rune][7]string{
+	' ':  {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'A':  {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B':  {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C':  {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D':  {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E':  {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F':  {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G':  {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H':  {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I':  {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J':  {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K':  {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L':  {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M':  {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N':  {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O':  {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P':  {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q':  {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R':  {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S':  {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T':  {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U':  {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V':  {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W':  {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X':  {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y':  {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z':  {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'0':  {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1':  {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2':  {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3':  {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4':  {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5':  {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6':  {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7':  {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8':  {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9':  {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	':':  {".....", "..#..", "..#..", ".....", "..#..", "..#..", "....."},
+	'-':  {".....", ".....", ".....", ".###.", ".....", ".....", "....."},
+	'.':  {".....", ".....", ".....", ".....", ".....", "..#..", "..#.."},
+	',':  {".....", ".....", ".....", ".....", "..#..", "..#..", ".#..."},
+	'/':  {"....#", "....#", "...#.", "..#..", ".#...", "#....", "#...."},
+	'(':  {"...#.", "..#..", ".#...", ".#...", ".#...", "..#..", "...#."},
+	')':  {".#...", "..#..", "...#.", "...#.", "...#.", "..#..", ".#..."},
+	'·':  {".....", ".....", ".....", "..#..", ".....", ".....", "....."},
+	'#':  {".#.#.", ".#.#.", "#####", ".#.#.", "#####", ".#.#.", ".#.#."},
+	'&':  {".##..", "#..#.", "#.#..", ".#...", "#.#.#", "#..#.", ".##.#"},
+	'+':  {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'\'': {"..#..", "..#..", ".#...", ".....", ".....", ".....", "....."},
+	'_':  {".....", ".....", ".....", ".....", ".....", ".....", "#####"},
+	'?':  {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+}
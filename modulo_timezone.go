@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ FECHAS Y ZONAS HORARIAS ------------------------ //
+
+// Modelo de tiempo de la API:
+//   - Las columnas DATETIME de MySQL guardan la hora local de zonaInstitucion, sin desfase.
+//     Las marcas de tiempo las calcula la API con fechaHoraBD, no NOW() de MySQL.
+//   - Las fechas con hora de las respuestas van en RFC 3339 con el desfase de la zona
+//     del usuario (o la de la institución si no eligió una).
+//   - Las fechas que envía el cliente sin desfase se interpretan en la zona del usuario.
+//   - Las horas de clase y actividades (TIME) y las fechas sin hora (DATE) son de
+//     calendario en la institución y no se convierten.
+
+const vigenciaZonaUsuario = time.Hour
+
+// Valor para una columna DATETIME
+func fechaHoraBD(t time.Time) string {
+	return t.In(zonaInstitucion).Format(time.DateTime)
+}
+
+// DATETIME o DATE de MySQL en zonaInstitucion; soloFecha si no trae hora
+func leerFechaHoraBD(valor string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateTime, valor, zonaInstitucion); err == nil {
+		return t, false, nil
+	}
+	if len(valor) != len(time.DateOnly) {
+		return time.Time{}, false, fmt.Errorf("fecha inválida %q", valor)
+	}
+	t, err := time.ParseInLocation(time.DateOnly, valor, zonaInstitucion)
+	return t, true, err
+}
+
+// Valor de la base en RFC 3339 con el desfase de zona; las fechas sin hora quedan
+// YYYY-MM-DD. nil si está vacío o no se puede leer.
+func rfc3339BD(valor string, zona *time.Location) *string {
+	if valor == "" {
+		return nil
+	}
+	t, soloFecha, err := leerFechaHoraBD(valor)
+	if err != nil {
+		return nil
+	}
+	texto := t.In(zona).Format(time.RFC3339)
+	if soloFecha {
+		texto = t.Format(time.DateOnly)
+	}
+	return &texto
+}
+
+// Fecha enviada por el cliente convertida al valor que se guarda en la base. Con
+// desfase (RFC 3339) es un instante; sin él se toma en zona. Sin hora se guarda
+// la misma fecha.
+func fechaClienteBD(valor string, zona *time.Location) (string, error) {
+	valor = strings.TrimSpace(valor)
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return fechaHoraBD(t), nil
+	}
+	for _, formato := range []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(formato, valor, zona); err == nil {
+			return fechaHoraBD(t), nil
+		}
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, valor, zona); err == nil {
+		return t.Format(time.DateOnly), nil
+	}
+	return "", fmt.Errorf("fecha inválida %q", valor)
+}
+
+// Zona preferida del usuario (Usuarios.T_zonaHoraria, cacheada en Redis) o la de la institución
+func zonaUsuario(codUsuario string) *time.Location {
+	nombre, err := rdb.Get(ctx, "TimeZone:"+codUsuario).Result()
+	if errors.Is(err, redis.Nil) {
+		var valor sql.NullString
+		err = db.QueryRow("SELECT T_zonaHoraria FROM Usuarios WHERE T_codUsuario = ?", codUsuario).Scan(&valor)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Database error leyendo zona horaria: %v", err)
+			return zonaInstitucion
+		}
+		nombre = valor.String
+		if err := rdb.Set(ctx, "TimeZone:"+codUsuario, nombre, vigenciaZonaUsuario).Err(); err != nil {
+			log.Printf("Error de Redis guardando zona horaria: %v", err)
+		}
+	} else if err != nil {
+		log.Printf("Error de Redis leyendo zona horaria: %v", err)
+		return zonaInstitucion
+	}
+
+	if nombre == "" {
+		return zonaInstitucion
+	}
+	zona, err := time.LoadLocation(nombre)
+	if err != nil {
+		log.Printf("Zona horaria guardada inválida %q para %s: %v", nombre, codUsuario, err)
+		return zonaInstitucion
+	}
+	return zona
+}
+
+// Nombre IANA válido para guardar como preferencia
+func zonaValida(nombre string) bool {
+	if nombre == "" || nombre == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(nombre)
+	return err == nil
+}
+
+func getTimezonePreference(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+	zona := zonaUsuario(claims.UserID)
+
+	c.JSON(200, gin.H{
+		"timezone":            zona.String(),
+		"institutionTimezone": zonaInstitucion.String(),
+		"now":                 time.Now().In(zona).Format(time.RFC3339),
+	})
+}
+
+// Guarda la zona del usuario; vacía vuelve a la de la institución
+func setTimezonePreference(c *gin.Context) {
+	claims := c.MustGet("user_claims").(*Claims)
+
+	var req ZonaHorariaRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	req.ZonaHoraria = strings.TrimSpace(req.ZonaHoraria)
+
+	var valor *string
+	if req.ZonaHoraria != "" {
+		if !zonaValida(req.ZonaHoraria) {
+			c.JSON(400, gin.H{"error": "timezone debe ser un nombre IANA, por ejemplo America/Bogota"})
+			return
+		}
+		valor = &req.ZonaHoraria
+	}
+
+	antes := zonaUsuario(claims.UserID).String()
+
+	result, err := db.Exec("UPDATE Usuarios SET T_zonaHoraria = ? WHERE T_codUsuario = ?", valor, claims.UserID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 && idUsuarioPorCodigo(claims.UserID) == 0 {
+		c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	if err := rdb.Del(ctx, "TimeZone:"+claims.UserID, "UserInfo:"+claims.UserID).Err(); err != nil {
+		log.Printf("Error de Redis: %v", err)
+	}
+
+	despues := zonaUsuario(claims.UserID).String()
+	auditar(c, idUsuarioPorCodigo(claims.UserID), accionConfigurarZonaHoraria, objetivoUsuario, claims.UserID,
+		"Zona horaria actualizada | Antes: "+antes+" | Después: "+despues+" | Usuario: "+claims.UserID)
+
+	c.JSON(200, gin.H{
+		"message":  "Zona horaria actualizada",
+		"timezone": despues,
+	})
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ SEGUNDO FACTOR (TOTP) ------------------------ //
+
+const (
+	emisorTOTP           = "UPB Planner"
+	pasoTOTP             = 30
+	digitosTOTP          = 6
+	codigosRecuperacion  = 10
+	duracionDesafioMFA   = 5 * time.Minute
+	msgTOTPSinConfigurar = "2FA no configurado en el servidor"
+)
+
+var base32SinRelleno = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Clave AES-256 con la que se cifran los secretos (TOTP_ENCRYPTION_KEY en base64)
+var claveTOTP []byte
+
+func cargarClaveTOTP() []byte {
+	valor := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if valor == "" {
+		log.Println("TOTP_ENCRYPTION_KEY no configurada, no se podrá enrolar 2FA")
+		return nil
+	}
+
+	clave, err := base64.StdEncoding.DecodeString(valor)
+	if err != nil || len(clave) != 32 {
+		log.Fatal("TOTP_ENCRYPTION_KEY debe ser 32 bytes en base64")
+	}
+	return clave
+}
+
+// Lo que se guarda en Redis bajo "2fa:<usuario>"
+type estadoTOTP struct {
+	Secreto      string   `json:"secreto"` // cifrado con AES-GCM
+	Activo       bool     `json:"activo"`
+	Recuperacion []string `json:"recuperacion"` // sha256 de los códigos
+	UltimoPaso   int64    `json:"ultimoPaso"`   // evita reutilizar un código
+}
+
+func leerEstadoTOTP(c context.Context, usuario string) (*estadoTOTP, error) {
+	val, err := rdb.Get(c, "2fa:"+usuario).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var estado estadoTOTP
+	if err := json.Unmarshal([]byte(val), &estado); err != nil {
+		return nil, err
+	}
+	return &estado, nil
+}
+
+func guardarEstadoTOTP(c context.Context, usuario string, estado *estadoTOTP) error {
+	data, err := json.Marshal(estado)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(c, "2fa:"+usuario, data, 0).Err()
+}
+
+func cifrarSecreto(secreto string) (string, error) {
+	bloque, err := aes.NewCipher(claveTOTP)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(bloque)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secreto), nil)), nil
+}
+
+func descifrarSecreto(cifrado string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(cifrado)
+	if err != nil {
+		return "", err
+	}
+
+	bloque, err := aes.NewCipher(claveTOTP)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(bloque)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("secreto cifrado inválido")
+	}
+
+	plano, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plano), nil
+}
+
+// Código de 6 dígitos para un paso de 30 segundos (RFC 6238, HMAC-SHA1)
+func codigoTOTP(secreto []byte, paso int64) string {
+	var contador [8]byte
+	binary.BigEndian.PutUint64(contador[:], uint64(paso))
+
+	mac := hmac.New(sha1.New, secreto)
+	mac.Write(contador[:])
+	suma := mac.Sum(nil)
+
+	offset := suma[len(suma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(suma[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digitosTOTP, valor%1000000)
+}
+
+// Acepta el paso actual y uno a cada lado por diferencias de reloj.
+// Devuelve el paso que coincidió para no aceptarlo dos veces.
+func verificarCodigoTOTP(secretoB32, codigo string, ultimoPaso int64) (int64, bool) {
+	secreto, err := base32SinRelleno.DecodeString(secretoB32)
+	if err != nil {
+		return 0, false
+	}
+
+	actual := time.Now().Unix() / pasoTOTP
+	for _, paso := range []int64{actual - 1, actual, actual + 1} {
+		if paso <= ultimoPaso {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(codigoTOTP(secreto, paso)), []byte(codigo)) == 1 {
+			return paso, true
+		}
+	}
+	return 0, false
+}
+
+func hashCodigoRecuperacion(codigo string) string {
+	suma := sha256.Sum256([]byte(strings.ToUpper(strings.ReplaceAll(codigo, "-", ""))))
+	return hex.EncodeToString(suma[:])
+}
+
+// Valida un código TOTP o, si no coincide, uno de recuperación (que se consume).
+// Actualiza el estado en memoria; quien llama debe guardarlo.
+func validarSegundoFactor(estado *estadoTOTP, codigo string) (bool, bool, error) {
+	secreto, err := descifrarSecreto(estado.Secreto)
+	if err != nil {
+		return false, false, err
+	}
+
+	codigo = strings.TrimSpace(codigo)
+
+	if paso, ok := verificarCodigoTOTP(secreto, codigo, estado.UltimoPaso); ok {
+		estado.UltimoPaso = paso
+		return true, false, nil
+	}
+
+	hash := hashCodigoRecuperacion(codigo)
+	for i, guardado := range estado.Recuperacion {
+		if subtle.ConstantTimeCompare([]byte(guardado), []byte(hash)) == 1 {
+			estado.Recuperacion = append(estado.Recuperacion[:i], estado.Recuperacion[i+1:]...)
+			return true, true, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+// Guarda temporalmente el usuario ya autenticado en LDAP mientras ingresa el código
+func crearDesafioMFA(c context.Context, u *User) (string, error) {
+	bytesDesafio := make([]byte, 24)
+	if _, err := rand.Read(bytesDesafio); err != nil {
+		return "", err
+	}
+	desafio := base64.RawURLEncoding.EncodeToString(bytesDesafio)
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return "", err
+	}
+
+	if err := rdb.Set(c, "mfa:"+desafio, data, duracionDesafioMFA).Err(); err != nil {
+		return "", err
+	}
+	return desafio, nil
+}
+
+// Genera secreto y códigos de recuperación. Queda pendiente hasta confirmarse con /auth/2fa/activate
+func enrollTOTP(c *gin.Context) {
+	if claveTOTP == nil {
+		c.JSON(503, gin.H{"error": msgTOTPSinConfigurar})
+		return
+	}
+
+	claims := c.MustGet("user_claims").(*Claims)
+
+	actual, err := leerEstadoTOTP(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if actual != nil && actual.Activo {
+		c.JSON(409, gin.H{"error": "El usuario ya tiene 2FA activo"})
+		return
+	}
+
+	bytesSecreto := make([]byte, 20)
+	if _, err := rand.Read(bytesSecreto); err != nil {
+		log.Printf("Error generando secreto: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	secreto := base32SinRelleno.EncodeToString(bytesSecreto)
+
+	cifrado, err := cifrarSecreto(secreto)
+	if err != nil {
+		log.Printf("Error cifrando secreto: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	codigos := make([]string, codigosRecuperacion)
+	hashes := make([]string, codigosRecuperacion)
+	for i := range codigos {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("Error generando códigos: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		codigo := base32SinRelleno.EncodeToString(b)
+		codigos[i] = codigo[:4] + "-" + codigo[4:]
+		hashes[i] = hashCodigoRecuperacion(codigo)
+	}
+
+	estado := &estadoTOTP{Secreto: cifrado, Recuperacion: hashes}
+	if err := guardarEstadoTOTP(c.Request.Context(), claims.UserID, estado); err != nil {
+		log.Printf("Error al guardar en Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Error interno al guardar en caché"})
+		return
+	}
+
+	parametros := url.Values{}
+	parametros.Set("secret", secreto)
+	parametros.Set("issuer", emisorTOTP)
+	parametros.Set("algorithm", "SHA1")
+	parametros.Set("digits", strconv.Itoa(digitosTOTP))
+	parametros.Set("period", strconv.Itoa(pasoTOTP))
+
+	uri := "otpauth://totp/" + url.PathEscape(emisorTOTP+":"+claims.UserID) + "?" + parametros.Encode()
+
+	c.JSON(200, gin.H{
+		"secret":          secreto,
+		"provisioningUri": uri,
+		"recoveryCodes":   codigos,
+	})
+}
+
+// Confirma el enrolamiento con un primer código válido
+func activateTOTP(c *gin.Context) {
+	var req TOTPCode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+	if claveTOTP == nil {
+		c.JSON(503, gin.H{"error": msgTOTPSinConfigurar})
+		return
+	}
+
+	claims := c.MustGet("user_claims").(*Claims)
+
+	estado, err := leerEstadoTOTP(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if estado == nil {
+		c.JSON(404, gin.H{"error": "No hay un enrolamiento pendiente"})
+		return
+	}
+	if estado.Activo {
+		c.JSON(409, gin.H{"error": "El usuario ya tiene 2FA activo"})
+		return
+	}
+
+	secreto, err := descifrarSecreto(estado.Secreto)
+	if err != nil {
+		log.Printf("Error descifrando secreto: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	paso, ok := verificarCodigoTOTP(secreto, strings.TrimSpace(req.Code), estado.UltimoPaso)
+	if !ok {
+		c.JSON(401, gin.H{"error": "Código inválido"})
+		return
+	}
+
+	estado.Activo = true
+	estado.UltimoPaso = paso
+	if err := guardarEstadoTOTP(c.Request.Context(), claims.UserID, estado); err != nil {
+		log.Printf("Error al guardar en Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Error interno al guardar en caché"})
+		return
+	}
+
+	userID := idUsuarioPorCodigo(claims.UserID)
+	descripcion := fmt.Sprintf("Se activó 2FA | Usuario ID: %d | Username: %s", userID, claims.UserID)
+	auditar(c, userID, accionActivar2FA, objetivoUsuario, claims.UserID, descripcion)
+
+	c.JSON(200, gin.H{"message": "2FA activado, inicie sesión nuevamente"})
+}
+
+// Desactiva 2FA; exige un código TOTP o de recuperación
+func disableTOTP(c *gin.Context) {
+	var req TOTPCode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+	if claveTOTP == nil {
+		c.JSON(503, gin.H{"error": msgTOTPSinConfigurar})
+		return
+	}
+
+	claims := c.MustGet("user_claims").(*Claims)
+
+	estado, err := leerEstadoTOTP(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if estado == nil {
+		c.JSON(404, gin.H{"error": "El usuario no tiene 2FA"})
+		return
+	}
+
+	if estado.Activo {
+		ok, _, err := validarSegundoFactor(estado, req.Code)
+		if err != nil {
+			log.Printf("Error descifrando secreto: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !ok {
+			c.JSON(401, gin.H{"error": "Código inválido"})
+			return
+		}
+	}
+
+	if err := rdb.Del(c.Request.Context(), "2fa:"+claims.UserID).Err(); err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	userID := idUsuarioPorCodigo(claims.UserID)
+	descripcion := fmt.Sprintf("Se desactivó 2FA | Usuario ID: %d | Username: %s", userID, claims.UserID)
+	auditar(c, userID, accionDesactivar2FA, objetivoUsuario, claims.UserID, descripcion)
+
+	c.JSON(200, gin.H{"message": "2FA desactivado"})
+}
+
+// Segundo paso del login: se entrega el JWT solo si el código es válido
+func loginTOTP(c *gin.Context) {
+	var req TOTPLogin
+	if err := c.ShouldBindJSON(&req); err != nil || req.Challenge == "" {
+		c.JSON(400, gin.H{"error": "JSON mal formado"})
+		return
+	}
+	if claveTOTP == nil {
+		c.JSON(503, gin.H{"error": msgTOTPSinConfigurar})
+		return
+	}
+
+	// GETDEL: solo una petición puede tomar el desafío; se lee el TTL en la misma
+	// transacción para devolverlo si el código falla
+	clave := "mfa:" + req.Challenge
+	var ttl *redis.DurationCmd
+	var tomado *redis.StringCmd
+	_, err := rdb.TxPipelined(c.Request.Context(), func(pipe redis.Pipeliner) error {
+		ttl = pipe.PTTL(c.Request.Context(), clave)
+		tomado = pipe.GetDel(c.Request.Context(), clave)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Error de Redis: %v", err)
+		}
+		c.JSON(401, gin.H{"error": "Desafío inválido o expirado, inicie sesión nuevamente"})
+		return
+	}
+	val := tomado.Val()
+
+	restaurar := func() {
+		if restante := ttl.Val(); restante > 0 {
+			rdb.SetNX(ctx, clave, val, restante)
+		}
+	}
+
+	var userU User
+	if err := json.Unmarshal([]byte(val), &userU); err != nil {
+		log.Printf("Desafío MFA corrupto: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Los códigos incorrectos cuentan para el bloqueo igual que una contraseña incorrecta
+	if !verificarIntento(c, userU.Username) {
+		restaurar()
+		return
+	}
+
+	estado, ok, usoRecuperacion, err := consumirSegundoFactor(c.Request.Context(), userU.Username, req.Code)
+	if errors.Is(err, errSinTOTP) {
+		c.JSON(401, gin.H{"error": "Desafío inválido o expirado, inicie sesión nuevamente"})
+		return
+	}
+	if err != nil {
+		restaurar()
+		log.Printf("Error validando segundo factor: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		restaurar()
+		registrarFallo(c, userU.Username)
+		c.JSON(401, gin.H{"error": "Código inválido"})
+		return
+	}
+	limpiarFallos(userU.Username)
+
+	if usoRecuperacion {
+		userID := idUsuarioPorCodigo(userU.Username)
+		descripcion := fmt.Sprintf("Se usó un código de recuperación 2FA | Usuario ID: %d | Restantes: %d",
+			userID, len(estado.Recuperacion))
+		auditar(c, userID, accionUsarCodigoRecuperacion, objetivoUsuario, userU.Username, descripcion)
+	}
+
+	userU.MFA = true
+	finalizarLogin(c, &userU, gin.H{"recoveryCodesLeft": len(estado.Recuperacion)})
+}
+
+var errSinTOTP = errors.New("el usuario no tiene 2FA activo")
+
+// Valida el código y guarda el estado en una transacción con WATCH sobre 2fa:<usuario>.
+// Si otra petición cambió el estado entre la lectura y la escritura se repite con el
+// estado nuevo, así un código TOTP o de recuperación solo se acepta una vez.
+func consumirSegundoFactor(c context.Context, usuario, codigo string) (*estadoTOTP, bool, bool, error) {
+	clave := "2fa:" + usuario
+	var estado *estadoTOTP
+	var ok, usoRecuperacion bool
+
+	for intento := 0; intento < 5; intento++ {
+		err := rdb.Watch(c, func(tx *redis.Tx) error {
+			val, err := tx.Get(c, clave).Result()
+			if errors.Is(err, redis.Nil) {
+				return errSinTOTP
+			}
+			if err != nil {
+				return err
+			}
+			estado = &estadoTOTP{}
+			if err := json.Unmarshal([]byte(val), estado); err != nil {
+				return err
+			}
+			if !estado.Activo {
+				return errSinTOTP
+			}
+
+			ok, usoRecuperacion, err = validarSegundoFactor(estado, codigo)
+			if err != nil || !ok {
+				return err
+			}
+
+			data, err := json.Marshal(estado)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+				pipe.Set(c, clave, data, 0)
+				return nil
+			})
+			return err
+		}, clave)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return estado, ok, usoRecuperacion, err
+	}
+	return nil, false, false, errors.New("demasiados cambios simultáneos del estado 2FA")
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+//	------------------------ DESHACER ------------------------ //
+
+const limiteDeshacer = 20
+
+// Eliminaciones que se guardan por usuario en deshacer:<cod>; las más viejas se descartan
+const maxPendientesDeshacer = 50
+
+// Acciones que se pueden deshacer. Los procedimientos de borrado alternan
+// eliminar/recuperar, así que deshacer es volver a llamarlos.
+var accionesDeshacibles = []AccionAuditoria{
+	accionEliminarRecordatorio,
+	accionEliminarRecordatorios,
+	accionEliminarEtiqueta,
+	accionEliminarComentario,
+	accionEliminarActividad,
+}
+
+var errNadaQueRestaurar = errors.New("nada que restaurar")
+
+// Restaura las últimas N eliminaciones hechas por el usuario dentro de UNDO_WINDOW
+func undoDeletes(c *gin.Context) {
+	var req UndoRequest
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "formato invalido de json"})
+		return
+	}
+	if req.CodUsuario == nil || !AuthorityCheck(*req.CodUsuario, c) {
+		c.AbortWithStatusJSON(401, gin.H{"error": "Autorización requerida"})
+		return
+	}
+
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > limiteDeshacer {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("count debe estar entre 1 y %d", limiteDeshacer)})
+		return
+	}
+
+	codUsuario := *req.CodUsuario
+	ventana := ventanaDeshacer()
+
+	operaciones, err := eliminacionesRecientes(codUsuario, ventana, req.Count)
+	if err != nil {
+		log.Printf("Error de Redis: %v", err)
+		c.JSON(500, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if req.Preview {
+		c.JSON(200, gin.H{"operations": operaciones, "window": ventana.String()})
+		return
+	}
+
+	usuarioID := idUsuarioPorCodigo(codUsuario)
+	restauradas := []gin.H{}
+	omitidas := []gin.H{}
+
+	clave := "deshacer:" + codUsuario
+	for _, op := range operaciones {
+		// Sacar la operación de la lista la reserva: una petición simultánea ya no la encuentra
+		tomada, err := rdb.LRem(ctx, clave, 1, op.crudo).Result()
+		if err != nil {
+			log.Printf("Error de Redis: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+		if tomada == 0 {
+			omitidas = append(omitidas, gin.H{"id": op.ID, "reason": "Ya se deshizo"})
+			continue
+		}
+
+		ids, antes, despues, err := restaurarOperacion(op.LogEntry, codUsuario, usuarioID)
+		if err != nil {
+			if errors.Is(err, errNadaQueRestaurar) {
+				omitidas = append(omitidas, gin.H{"id": op.ID, "reason": "El registro ya no está eliminado o no pertenece al usuario"})
+				continue
+			}
+			// Se devuelve a la lista para poder intentarlo de nuevo
+			if err := rdb.LPush(ctx, clave, op.crudo).Err(); err != nil {
+				log.Printf("Error de Redis: %v", err)
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(500, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		descripcion := fmt.Sprintf("Se deshizo %s | Petición: %s | %s: %s | Usuario: %s",
+			op.Accion, op.RequestID, op.TipoObjetivo, ids, codUsuario)
+
+		evento := nuevoEvento(c, accionDeshacer, op.TipoObjetivo, ids)
+		evento.UsuarioID = usuarioID
+		evento.Antes = antes
+		evento.Despues = despues
+		evento.Descripcion = descripcion
+		registrarEvento(evento)
+
+		restauradas = append(restauradas, gin.H{
+			"id":         op.ID,
+			"action":     op.Accion,
+			"targetType": op.TipoObjetivo,
+			"targetIds":  ids,
+			"deletedAt":  op.Fecha,
+		})
+	}
+
+	if len(restauradas) > 0 {
+		limpiarCacheDeshacer(codUsuario)
+		invalidarCalendario(codUsuario)
+	}
+
+	c.JSON(200, gin.H{
+		"restored": restauradas,
+		"skipped":  omitidas,
+	})
+}
+
+func ventanaDeshacer() time.Duration {
+	return envDuration("UNDO_WINDOW", time.Hour)
+}
+
+// Una eliminación pendiente tal como está guardada en la lista, para poder quitarla con LREM
+type operacionDeshacer struct {
+	LogEntry
+	crudo string
+}
+
+// Guarda la eliminación en la lista del dueño en el momento de hacerla. Logs se
+// escribe por lotes, así que deshacer no puede esperar a encontrarla ahí.
+func registrarDeshacible(e EventoAuditoria, antes *string) {
+	if e.CodUsuario == "" || antes == nil {
+		return
+	}
+
+	id, err := rdb.Incr(ctx, "deshacer:secuencia").Result()
+	if err != nil {
+		log.Printf("Error de Redis guardando eliminación para deshacer: %v", err)
+		return
+	}
+	data, err := json.Marshal(LogEntry{
+		ID:           id,
+		Fecha:        time.Now().In(zonaInstitucion).Format(time.RFC3339),
+		UsuarioID:    e.UsuarioID,
+		CodUsuario:   e.CodUsuario,
+		Accion:       string(e.Accion),
+		Actor:        e.Actor,
+		TipoObjetivo: e.TipoObjetivo,
+		IDObjetivo:   e.IDObjetivo,
+		RequestID:    e.RequestID,
+		Antes:        json.RawMessage(*antes),
+	})
+	if err != nil {
+		log.Printf("Error serializando eliminación para deshacer: %v", err)
+		return
+	}
+
+	// La lista es del dueño de los datos: en una suplantación con escritura el actor
+	// es el administrador, pero lo que se puede deshacer es del usuario suplantado
+	clave := "deshacer:" + e.CodUsuario
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, clave, data)
+		pipe.LTrim(ctx, clave, 0, maxPendientesDeshacer-1)
+		pipe.Expire(ctx, clave, ventanaDeshacer())
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error de Redis guardando eliminación para deshacer: %v", err)
+	}
+}
+
+// Últimas eliminaciones del usuario dentro de la ventana que todavía no se han deshecho
+func eliminacionesRecientes(codUsuario string, ventana time.Duration, limite int) ([]operacionDeshacer, error) {
+	valores, err := rdb.LRange(ctx, "deshacer:"+codUsuario, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	desde := time.Now().Add(-ventana)
+	operaciones := []operacionDeshacer{}
+	for _, valor := range valores {
+		op := operacionDeshacer{crudo: valor}
+		if err := json.Unmarshal([]byte(valor), &op.LogEntry); err != nil {
+			log.Printf("Eliminación para deshacer ilegible: %v", err)
+			continue
+		}
+		fecha, err := time.Parse(time.RFC3339, op.Fecha)
+		if err != nil || fecha.Before(desde) {
+			continue
+		}
+		operaciones = append(operaciones, op)
+	}
+
+	// Una operación que falló se devuelve al inicio de la lista; el orden lo da el id
+	slices.SortFunc(operaciones, func(a, b operacionDeshacer) int { return cmp.Compare(b.ID, a.ID) })
+	if len(operaciones) > limite {
+		operaciones = operaciones[:limite]
+	}
+	return operaciones, nil
+}
+
+// Vuelve a llamar al procedimiento de cada objeto que la operación dejó eliminado.
+// Solo se restaura lo que estaba activo antes de la operación y sigue eliminado ahora,
+// así no se borra algo que el usuario ya recuperó a mano.
+func restaurarOperacion(op LogEntry, codUsuario string, usuarioID int) (string, any, any, error) {
+	if len(op.Antes) == 0 {
+		return "", nil, nil, errNadaQueRestaurar
+	}
+
+	switch AccionAuditoria(op.Accion) {
+	case accionEliminarRecordatorio, accionEliminarRecordatorios:
+		var antes []Reminders
+		if op.Accion == string(accionEliminarRecordatorio) {
+			var uno Reminders
+			if err := json.Unmarshal(op.Antes, &uno); err != nil {
+				return "", nil, nil, errNadaQueRestaurar
+			}
+			antes = []Reminders{uno}
+		} else if err := json.Unmarshal(op.Antes, &antes); err != nil {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+
+		var ids []int
+		for _, r := range antes {
+			if r.N_idUsuario == usuarioID && !eliminado(r.B_isDeleted) && !slices.Contains(ids, r.N_idRecordatorio) {
+				ids = append(ids, r.N_idRecordatorio)
+			}
+		}
+		actuales, err := consultarRecordatorios(porIdRecordatorio, ids)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		ids = ids[:0]
+		for _, r := range actuales {
+			if r.N_idUsuario == usuarioID && eliminado(r.B_isDeleted) && !slices.Contains(ids, r.N_idRecordatorio) {
+				ids = append(ids, r.N_idRecordatorio)
+			}
+		}
+		if err := alternarEnTransaccion("CALL eliminar_recordatorio(?)", ids); err != nil {
+			return "", nil, nil, err
+		}
+		despues, err := consultarRecordatorios(porIdRecordatorio, ids)
+		if err != nil {
+			log.Printf("Error leyendo recordatorios para auditoría: %v", err)
+		}
+		return listaIds(ids), actuales, despues, nil
+
+	case accionEliminarEtiqueta:
+		var antes []Tags
+		if err := json.Unmarshal(op.Antes, &antes); err != nil || len(antes) == 0 {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		id := antes[0].N_idEtiqueta
+		actual := instantaneaEtiqueta(id)
+		if len(actual) == 0 || actual[0].N_idUsuario != usuarioID ||
+			!eliminadoNulo(actual[0].B_isDeleted) || eliminadoNulo(antes[0].B_isDeleted) {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		if err := alternarEnTransaccion("CALL eliminar_etiqueta(?)", []int{id}); err != nil {
+			return "", nil, nil, err
+		}
+		return strconv.Itoa(id), actual, instantaneaEtiqueta(id), nil
+
+	case accionEliminarComentario:
+		var antes ofcComments
+		if err := json.Unmarshal(op.Antes, &antes); err != nil {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		actual := instantaneaComentario(antes.N_idComentarios)
+		if actual == nil || actual.N_idUsuario != usuarioID ||
+			!eliminadoNulo(actual.B_isDeleted) || eliminadoNulo(antes.B_isDeleted) {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		if err := alternarEnTransaccion("CALL eliminar_comentario(?)", []int{antes.N_idComentarios}); err != nil {
+			return "", nil, nil, err
+		}
+		// La caché de comentarios también se guarda por curso
+		rdb.Del(ctx, fmt.Sprintf("PersonalComments:%s-%v", codUsuario, antes.N_idCurso))
+		return strconv.Itoa(antes.N_idComentarios), actual, instantaneaComentario(antes.N_idComentarios), nil
+
+	case accionEliminarActividad:
+		var antes PersonalSchedule
+		if err := json.Unmarshal(op.Antes, &antes); err != nil {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		// instantaneaActividadPersonal solo busca entre las actividades del usuario
+		actual := instantaneaActividadPersonal(codUsuario, antes.N_idcourse)
+		if actual == nil || !eliminadoNulo(actual.IsDeleted) || eliminadoNulo(antes.IsDeleted) {
+			return "", nil, nil, errNadaQueRestaurar
+		}
+		if err := alternarEnTransaccion("CALL eliminar_actividad_personal(?)", []int{antes.N_idcourse}); err != nil {
+			return "", nil, nil, err
+		}
+		return strconv.Itoa(antes.N_idcourse), actual, instantaneaActividadPersonal(codUsuario, antes.N_idcourse), nil
+	}
+
+	return "", nil, nil, errNadaQueRestaurar
+}
+
+// Llama al procedimiento para cada id; o se restauran todos o ninguno
+func alternarEnTransaccion(procedimiento string, ids []int) error {
+	if len(ids) == 0 {
+		return errNadaQueRestaurar
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(procedimiento, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func eliminado(v *bool) bool {
+	return v != nil && *v
+}
+
+func eliminadoNulo(v *sql.NullBool) bool {
+	return v != nil && v.Valid && v.Bool
+}
+
+func listaIds(ids []int) string {
+	partes := make([]string, len(ids))
+	for i, id := range ids {
+		partes[i] = strconv.Itoa(id)
+	}
+	return strings.Join(partes, ",")
+}
+
+// Las lecturas de estos datos se sirven desde Redis
+func limpiarCacheDeshacer(codUsuario string) {
+	err := rdb.Del(ctx,
+		"Reminders:"+codUsuario,
+		"Reminder&Tags:"+codUsuario,
+		"TagsByUser:"+codUsuario,
+		"PersonalComments:"+codUsuario,
+		"PersonalSchedule:"+codUsuario,
+	).Err()
+	if err != nil {
+		fmt.Printf("\nError de conexión: %v", err)
+	}
+}
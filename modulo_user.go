@@ -6,7 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"time"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
@@ -39,7 +39,7 @@ func GetUserInfo(c *gin.Context) {
 
 	rows, err := db.Query(
 		`
-		SELECT u.N_idUsuario, u.T_nombre, u.T_correo, u.N_semestreActual, u.T_programa, u.TM_antelacionNotis, u.N_celular
+		SELECT u.N_idUsuario, u.T_nombre, u.T_correo, u.N_semestreActual, u.T_programa, u.TM_antelacionNotis, u.N_celular, u.T_zonaHoraria
 		FROM Usuarios u
 		WHERE u.T_codUsuario = ?
 		`,
@@ -66,6 +66,7 @@ func GetUserInfo(c *gin.Context) {
 			&userData.T_programa,
 			&userData.TM_antelacionNotis,
 			&userData.N_celular,
+			&userData.T_zonaHoraria,
 		)
 
 		if err != nil {
@@ -86,84 +87,38 @@ func GetUserInfo(c *gin.Context) {
 
 }
 
-// Guardar datos del token en redis
-func receiveTokenData(c *gin.Context) {
-	var data Token
-
-	// Leer json
-	if err := c.ShouldBindJSON(&data); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "El formato del JSON es incorrecto o faltan campos",
-		})
-		return
-	}
-
-	// Guardar en Redis
-	err := rdb.Set(ctx, "reset:"+data.UserId, data.Token, 15*time.Minute).Err()
-
-	if err != nil {
-		log.Printf("Error al guardar en Redis: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Error interno al guardar en caché",
-		})
-		return
-	}
-
-	// Log
-	descripcion := fmt.Sprintf("Token guardado en Redis | Usuario ID: %s", data.UserId)
-
-	go func(uID string, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertLogCod(uID, acc, desc)
-	}(data.UserId, "GUARDAR_TOKEN", descripcion)
-
-	// Respuesta exitosa
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Token guardado correctamente en Redis",
-	})
-}
+// Caché código -> id; el id de un usuario no cambia, así que no expira
+var (
+	muIdsUsuario    sync.RWMutex
+	cacheIdsUsuario = map[string]int{}
+)
 
-// Obtener token de redis
-func getToken(c *gin.Context) {
-	var req Token
+const maxCacheIdsUsuario = 10000
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": "JSON mal formado"})
-		return
+// Id numérico del usuario a partir de su código, 0 si no existe (para los logs)
+func idUsuarioPorCodigo(codUsuario string) int {
+	muIdsUsuario.RLock()
+	userID, ok := cacheIdsUsuario[codUsuario]
+	muIdsUsuario.RUnlock()
+	if ok {
+		return userID
 	}
 
-	val, err := rdb.Get(c.Request.Context(), "reset:"+req.UserId).Result()
-
+	err := db.QueryRow("SELECT N_idUsuario FROM Usuarios WHERE T_codUsuario = ?", codUsuario).Scan(&userID)
 	if err != nil {
-		fmt.Printf("Error de Redis: %v\n", err)
-		c.JSON(401, gin.H{"error": "Sesión no encontrada o expirada"})
-		return
+		log.Println("Error obteniendo usuario para log:", err)
+		return 0
 	}
 
-	if val != req.Token {
-		c.JSON(401, gin.H{"error": "El token no coincide para este usuario"})
-		return
+	// Solo se guardan los encontrados, para que una cuenta nueva no quede en 0
+	muIdsUsuario.Lock()
+	if len(cacheIdsUsuario) >= maxCacheIdsUsuario {
+		cacheIdsUsuario = map[string]int{}
 	}
+	cacheIdsUsuario[codUsuario] = userID
+	muIdsUsuario.Unlock()
 
-	// Log
-	userID, err := strconv.Atoi(req.UserId)
-	descripcion := fmt.Sprintf("Se validó el token | Usuario ID: %s", req.UserId)
-
-	go func(uID int, acc, desc string) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Recuperado de pánico en log (Eliminar): %v", r)
-			}
-		}()
-		insertarLog(uID, acc, desc)
-	}(userID, "VALIDAR_TOKEN", descripcion)
-
-	c.JSON(200, gin.H{"userId": req.UserId})
+	return userID
 }
 
 // Guardar paleta de colores en redis
@@ -192,11 +147,11 @@ func receivePaletteData(c *gin.Context) {
 
 	descripcion := "Paleta guardada en Redis | Usuario ID: " + data.UserId
 
-	insertarLog(
-		userID,
-		"GUARDAR_PALETA",
-		descripcion,
-	)
+	evento := nuevoEvento(c, accionGuardarPaleta, objetivoUsuario, data.UserId)
+	evento.UsuarioID = userID
+	evento.Despues = data
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	// Respuesta exitosa
 	c.JSON(http.StatusOK, gin.H{
@@ -257,11 +212,11 @@ func receiveOnboardingStatus(c *gin.Context) {
 	descripcion := "Onboarding actualizado en Redis | Usuario ID: " + data.UserId +
 		" | Estado: " + data.Status
 
-	insertarLog(
-		userID,
-		"GUARDAR_ONBOARDING",
-		descripcion,
-	)
+	evento := nuevoEvento(c, accionGuardarOnboarding, objetivoUsuario, data.UserId)
+	evento.UsuarioID = userID
+	evento.Despues = data
+	evento.Descripcion = descripcion
+	registrarEvento(evento)
 
 	// Respuesta exitosa
 	c.JSON(http.StatusOK, gin.H{